@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math"
+
+	"github.com/prometheus/common/model"
+)
+
+// aggregations lists the functions accepted by --aggregate.
+var aggregations = []string{"sum", "avg", "min", "max", "count", "stddev"}
+
+// aggregateSamples collapses samples into one sample per distinct combination
+// of the groupBy label values, using the aggregation function fn. The
+// resulting samples only carry the metric name and the groupBy labels, so
+// output identifies the offending group.
+func aggregateSamples(samples model.Vector, name string, groupBy []string, fn string) model.Vector {
+	groups := map[model.Fingerprint]int{}
+	aggregated := model.Vector{}
+	values := [][]float64{}
+
+	for _, value := range samples {
+		metric := model.Metric{"__name__": model.LabelValue(name)}
+		for _, label := range groupBy {
+			if labelValue, ok := value.Metric[model.LabelName(label)]; ok {
+				metric[model.LabelName(label)] = labelValue
+			}
+		}
+		fingerprint := metric.Fingerprint()
+		group, ok := groups[fingerprint]
+		if !ok {
+			group = len(aggregated)
+			groups[fingerprint] = group
+			aggregated = append(aggregated, &model.Sample{Metric: metric, Timestamp: value.Timestamp})
+			values = append(values, nil)
+		}
+		values[group] = append(values[group], float64(value.Value))
+	}
+
+	for i, group := range aggregated {
+		group.Value = model.SampleValue(aggregate(values[i], fn))
+	}
+	return aggregated
+}
+
+// aggregate applies the aggregation function fn to values, which is never
+// empty. stddev is the population standard deviation, as in PromQL.
+func aggregate(values []float64, fn string) float64 {
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	mean := sum / float64(len(values))
+
+	switch fn {
+	case "avg":
+		return mean
+	case "min", "max":
+		result := values[0]
+		for _, value := range values[1:] {
+			if fn == "min" {
+				result = math.Min(result, value)
+			} else {
+				result = math.Max(result, value)
+			}
+		}
+		return result
+	case "count":
+		return float64(len(values))
+	case "stddev":
+		variance := 0.0
+		for _, value := range values {
+			variance += (value - mean) * (value - mean)
+		}
+		return math.Sqrt(variance / float64(len(values)))
+	default:
+		return sum
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestAggregateSamples(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{"__name__": "http_requests_total", "code": "500", "handler": "a"}, Value: 2},
+		{Metric: model.Metric{"__name__": "http_requests_total", "code": "500", "handler": "b"}, Value: 3},
+		{Metric: model.Metric{"__name__": "http_requests_total", "code": "200", "handler": "a"}, Value: 10},
+	}
+
+	total := aggregateSamples(samples, "http_requests_total", nil, "sum")
+	if len(total) != 1 || total[0].Value != 15 {
+		t.Fatalf("expected a single sum of 15, got %v", total)
+	}
+
+	grouped := aggregateSamples(samples, "http_requests_total", []string{"code"}, "sum")
+	if len(grouped) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(grouped))
+	}
+	for _, group := range grouped {
+		if _, ok := group.Metric["handler"]; ok {
+			t.Errorf("group %s should not carry the handler label", group.Metric)
+		}
+		switch group.Metric["code"] {
+		case "500":
+			if group.Value != 5 {
+				t.Errorf("expected code 500 to sum to 5, got %f", group.Value)
+			}
+		case "200":
+			if group.Value != 10 {
+				t.Errorf("expected code 200 to sum to 10, got %f", group.Value)
+			}
+		default:
+			t.Errorf("unexpected group %s", group.Metric)
+		}
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	values := []float64{2, 4, 4, 4, 5, 5, 7, 9}
+	for fn, expected := range map[string]float64{
+		"sum":    40,
+		"avg":    5,
+		"min":    2,
+		"max":    9,
+		"count":  8,
+		"stddev": 2,
+	} {
+		if got := aggregate(values, fn); got != expected {
+			t.Errorf("expected %s to be %f, got %f", fn, expected, got)
+		}
+	}
+}
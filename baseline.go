@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+// loadBaseline reads the expected values of series from path, which holds
+// series in the Prometheus text format, such as a saved scrape of a known
+// good run. Values are keyed by the series' metric string.
+func loadBaseline(path string) (map[string]float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read baseline file %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse baseline file %s: %v", path, err)
+	}
+	baseline := map[string]float64{}
+	for _, sample := range extractSamples(families) {
+		baseline[sample.Metric.String()] = float64(sample.Value)
+	}
+	return baseline, nil
+}
+
+// deviationPercent returns how far value is from baseline, as a percentage
+// of the baseline. Any value but 0 deviates infinitely from a baseline of 0.
+func deviationPercent(value float64, baseline float64) float64 {
+	if baseline == 0 {
+		if value == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return math.Abs(value-baseline) / math.Abs(baseline) * 100
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadBaseline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "baseline.prom")
+	if err := os.WriteFile(path, []byte("requests{job=\"a\"} 100\nrequests{job=\"b\"} 50\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	baseline, err := loadBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(baseline) != 2 || baseline[`requests{job="a"}`] != 100 {
+		t.Errorf("unexpected baseline %v", baseline)
+	}
+	if _, err := loadBaseline(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("expected an error for a missing baseline file")
+	}
+}
+
+func TestDeviationPercent(t *testing.T) {
+	if got := deviationPercent(90, 100); got != 10 {
+		t.Errorf("expected 10%%, got %f", got)
+	}
+	if got := deviationPercent(1, 0); !math.IsInf(got, 1) {
+		t.Errorf("expected an infinite deviation from 0, got %f", got)
+	}
+	if got := deviationPercent(0, 0); got != 0 {
+		t.Errorf("expected no deviation, got %f", got)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/prometheus/common/model"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+// cardinalityGroup is the number of series carrying a value of a label.
+type cardinalityGroup struct {
+	Value  model.LabelValue
+	Series int
+}
+
+// cardinality counts samples per value of label, largest groups first.
+// Samples without the label are counted under an empty value.
+func cardinality(samples model.Vector, label model.LabelName) []cardinalityGroup {
+	counts := map[model.LabelValue]int{}
+	for _, sample := range samples {
+		counts[sample.Metric[label]] += 1
+	}
+	groups := []cardinalityGroup{}
+	for value, count := range counts {
+		groups = append(groups, cardinalityGroup{Value: value, Series: count})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Series != groups[j].Series {
+			return groups[i].Series > groups[j].Series
+		}
+		return groups[i].Value < groups[j].Value
+	})
+	return groups
+}
+
+// cardinalityReport prints the series count of every group of samples by
+// label, returning critical when a group has more than max series. A max of
+// 0 never fails.
+func cardinalityReport(samples model.Vector, label string, max int) int {
+	status := sensu.CheckStateOK
+	for _, group := range cardinality(samples, model.LabelName(label)) {
+		if max > 0 && group.Series > max {
+			printf("%s=%s has %d series. Check require at most %d\n", label, group.Value, group.Series, max)
+			status = sensu.CheckStateCritical
+		} else {
+			printf("%s=%s has %d series\n", label, group.Value, group.Series)
+		}
+	}
+	return status
+}
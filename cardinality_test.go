@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+func TestCardinality(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{"job": "node"}},
+		{Metric: model.Metric{"job": "app"}},
+		{Metric: model.Metric{"job": "node"}},
+		{Metric: model.Metric{}},
+	}
+	groups := cardinality(samples, "job")
+	if len(groups) != 3 || groups[0] != (cardinalityGroup{"node", 2}) || groups[1] != (cardinalityGroup{"", 1}) {
+		t.Errorf("unexpected groups %v", groups)
+	}
+
+	var status int
+	output := captureOutput(t, func() { status = cardinalityReport(samples, "job", 1) })
+	if status != sensu.CheckStateCritical || output != "job=node has 2 series. Check require at most 1\njob= has 1 series\njob=app has 1 series\n" {
+		t.Errorf("unexpected report %d %q", status, output)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/url"
+
+	"github.com/prometheus/common/model"
+)
+
+// compareSamples returns the difference, or the ratio with mode ratio, of
+// every series of primary to the series with the same labels scraped from the
+// --compare-url target. Series missing from either side are dropped. The
+// results are named after the metric and the host of target.
+func compareSamples(primary model.Vector, compared model.Vector, target string, mode string) model.Vector {
+	host := target
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	operator := " - "
+	if mode == "ratio" {
+		operator = " / "
+	}
+
+	others := map[model.Fingerprint]*model.Sample{}
+	for _, sample := range compared {
+		others[joinKey(sample.Metric, nil)] = sample
+	}
+	results := model.Vector{}
+	for _, sample := range primary {
+		other, ok := others[joinKey(sample.Metric, nil)]
+		if !ok {
+			logger.Debug("series missing from compared target", "series", sample.Metric.String(), "target", target)
+			continue
+		}
+		value := sample.Value - other.Value
+		if mode == "ratio" {
+			value = sample.Value / other.Value
+		}
+		labels := sample.Metric.Clone()
+		labels[model.MetricNameLabel] = model.LabelValue(string(sample.Metric[model.MetricNameLabel]) + operator + host)
+		results = append(results, &model.Sample{Metric: labels, Value: value, Timestamp: sample.Timestamp})
+	}
+	return results
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+func TestCompareSamples(t *testing.T) {
+	primary := model.Vector{
+		{Metric: model.Metric{"__name__": "position", "db": "a"}, Value: 120},
+		{Metric: model.Metric{"__name__": "position", "db": "b"}, Value: 50},
+	}
+	compared := model.Vector{
+		{Metric: model.Metric{"__name__": "position", "db": "a"}, Value: 100},
+	}
+	results := compareSamples(primary, compared, "http://replica:9104/metrics", "difference")
+	if len(results) != 1 || results[0].Value != 20 || results[0].Metric["__name__"] != "position - replica:9104" {
+		t.Errorf("unexpected difference %v", results)
+	}
+	results = compareSamples(primary, compared, "http://replica:9104/metrics", "ratio")
+	if len(results) != 1 || results[0].Value != 1.2 || results[0].Metric["__name__"] != "position / replica:9104" {
+		t.Errorf("unexpected ratio %v", results)
+	}
+}
+
+func TestExecuteCheckCompareUrl(t *testing.T) {
+	setupPlugin(t, "binlog_position{db=\"a\"} 1500\n")
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "binlog_position{db=\"a\"} 1000\n")
+	}))
+	t.Cleanup(replica.Close)
+	plugin.CompareUrl = replica.URL
+	plugin.Compare = "difference"
+	plugin.Metrics = []string{"binlog_position"}
+	plugin.Max = 100
+
+	if _, err := checkArgs(nil); err != nil {
+		t.Fatal(err)
+	}
+	out := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical for a lag of 500, got %d (%v)", status, err)
+		}
+	})
+	want := fmt.Sprintf("Metric binlog_position - %s{db=\"a\"} is at 500.000000. Check require maximum 100.000000\n", replica.Listener.Addr())
+	if out != want {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	plugin.CompareUrl = plugin.Urls[0]
+	if _, err := checkArgs(nil); err == nil {
+		t.Error("expected an error comparing --url to itself")
+	}
+}
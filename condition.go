@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// condNode is a node of a parsed --condition, which holds or not for the
+// value of a series.
+type condNode interface {
+	holds(value float64) (bool, error)
+}
+
+type compareNode struct {
+	op          string
+	left, right exprNode
+}
+
+type logicNode struct {
+	op          string
+	left, right condNode
+}
+
+type notNode struct {
+	operand condNode
+}
+
+func (n compareNode) holds(value float64) (bool, error) {
+	resolve := func(string) (float64, error) { return value, nil }
+	left, err := n.left.eval(resolve)
+	if err != nil {
+		return false, err
+	}
+	right, err := n.right.eval(resolve)
+	if err != nil {
+		return false, err
+	}
+	switch n.op {
+	case "<":
+		return left < right, nil
+	case "<=":
+		return left <= right, nil
+	case ">":
+		return left > right, nil
+	case ">=":
+		return left >= right, nil
+	case "==":
+		return left == right, nil
+	default:
+		return left != right, nil
+	}
+}
+
+func (n logicNode) holds(value float64) (bool, error) {
+	left, err := n.left.holds(value)
+	if err != nil {
+		return false, err
+	}
+	if n.op == "&&" && !left || n.op == "||" && left {
+		return left, nil
+	}
+	return n.right.holds(value)
+}
+
+func (n notNode) holds(value float64) (bool, error) {
+	operand, err := n.operand.holds(value)
+	return !operand, err
+}
+
+// comparisons lists the comparison operators, two character ones first so
+// they are matched before their one character prefixes.
+var comparisons = []string{"<=", ">=", "==", "!=", "<", ">"}
+
+// parseCondition parses a --condition such as "value > 5 && value < 100".
+// Conditions compare arithmetic over value, the value of the series, and
+// numbers, combined with &&, || and ! and grouped by parentheses.
+func parseCondition(input string) (condNode, error) {
+	p := &exprParser{input: input}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != 0 {
+		return nil, fmt.Errorf("invalid condition '%s': unexpected '%c' at position %d", input, p.input[p.pos], p.pos+1)
+	}
+	return node, nil
+}
+
+// consume skips token when it is next in the input.
+func (p *exprParser) consume(token string) bool {
+	p.skipSpaces()
+	if strings.HasPrefix(p.input[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) parseOr() (condNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (condNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = logicNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (condNode, error) {
+	p.skipSpaces()
+	if !strings.HasPrefix(p.input[p.pos:], "!=") && p.consume("!") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+	// A parenthesis either groups conditions or starts arithmetic, as in
+	// (value + 1) > 2, so try a grouped condition first and parse a
+	// comparison from the same position when that fails.
+	start := p.pos
+	if p.consume("(") {
+		node, err := p.parseOr()
+		if err == nil && p.consume(")") {
+			return node, nil
+		}
+		p.pos = start
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (condNode, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range comparisons {
+		if !p.consume(op) {
+			continue
+		}
+		right, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range append(exprMetrics(left), exprMetrics(right)...) {
+			if name != "value" {
+				return nil, fmt.Errorf("invalid condition '%s': unknown name '%s', only value can be used", p.input, name)
+			}
+		}
+		return compareNode{op: op, left: left, right: right}, nil
+	}
+	return nil, fmt.Errorf("invalid condition '%s': expected a comparison at position %d", p.input, p.pos+1)
+}
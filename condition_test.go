@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestParseCondition(t *testing.T) {
+	for _, c := range []struct {
+		condition string
+		value     float64
+		holds     bool
+	}{
+		{"value > 5 && value < 100", 50, true},
+		{"value > 5 && value < 100", 100, false},
+		{"value != 0", 0, false},
+		{"value == 0 || value >= 10", 10, true},
+		{"!(value <= 1)", 2, true},
+		{"(value + 1) * 2 > 10", 4.5, true},
+		{"(value > 1 || value < -1) && value != 5", 5, false},
+		{"value / 1024 < 4", 5000, false},
+	} {
+		cond, err := parseCondition(c.condition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		holds, err := cond.holds(c.value)
+		if err != nil || holds != c.holds {
+			t.Errorf("expected %s for %f to be %t, got %t (%v)", c.condition, c.value, c.holds, holds, err)
+		}
+	}
+	for _, condition := range []string{"", "value", "value > ", "other > 1", "value > 1 &&", "(value > 1", "value > 1)"} {
+		if _, err := parseCondition(condition); err == nil {
+			t.Errorf("expected an error for condition '%s'", condition)
+		}
+	}
+}
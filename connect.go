@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+// StatusError is returned when an exporter responds with a non OK HTTP status.
+// Body holds the start of the response, for APIs explaining the error in it.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return "exporter returned non OK HTTP response status: " + e.Status
+}
+
+// connectTest scrapes every target and reports how many metric families and
+// samples each returned, without evaluating any thresholds.
+func connectTest(targets []string) int {
+	status := sensu.CheckStateOK
+	for _, target := range targets {
+		families, err := QueryMetricFamilies(target, pluginCredentials(), plugin.insecureSkipVerify, plugin.Cert, plugin.Key, plugin.CaCert)
+		if err != nil {
+			printf("%s: %s: %s\n", target, describeError(err), err)
+			status = sensu.CheckStateUnknown
+			continue
+		}
+		samples := 0
+		for _, family := range families {
+			samples += len(family.GetMetric())
+		}
+		printf("%s: OK, received %d metric families and %d samples\n", target, len(families), samples)
+	}
+	return status
+}
+
+// describeError names the stage a scrape failed at.
+func describeError(err error) string {
+	var dnsError *net.DNSError
+	var statusError *StatusError
+	var certError *tls.CertificateVerificationError
+	var unknownAuthorityError x509.UnknownAuthorityError
+	var hostnameError x509.HostnameError
+	var recordHeaderError tls.RecordHeaderError
+	var opError *net.OpError
+
+	switch {
+	case errors.As(err, &dnsError):
+		return "DNS lookup failed"
+	case errors.As(err, &statusError):
+		if statusError.StatusCode == http.StatusUnauthorized || statusError.StatusCode == http.StatusForbidden {
+			return "authentication failed"
+		}
+		return "unexpected HTTP status"
+	case errors.As(err, &certError), errors.As(err, &unknownAuthorityError), errors.As(err, &hostnameError), errors.As(err, &recordHeaderError):
+		return "TLS handshake failed"
+	case errors.As(err, &opError) && opError.Op == "dial" && opError.Timeout():
+		return "connection timed out"
+	case errors.As(err, &opError) && opError.Op == "dial":
+		return "connection failed"
+	default:
+		return "scrape failed"
+	}
+}
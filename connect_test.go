@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+func TestConnectTest(t *testing.T) {
+	setupPlugin(t, upMetrics)
+	out := captureOutput(t, func() {
+		if status := connectTest([]string{plugin.Urls[0]}); status != sensu.CheckStateOK {
+			t.Errorf("expected OK, got %d", status)
+		}
+	})
+	if out != plugin.Urls[0]+": OK, received 1 metric families and 3 samples\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestConnectTestMetric(t *testing.T) {
+	setupPlugin(t, upMetrics+"errors_total 2\n")
+	plugin.ConnectTest = true
+	plugin.Metrics = []string{"errors_total"}
+	out := captureOutput(t, func() { connectTest([]string{plugin.Urls[0]}) })
+	if out != plugin.Urls[0]+": OK, received 2 metric families and 4 samples\n" {
+		t.Errorf("expected the series of every metric to be counted, got %q", out)
+	}
+}
+
+func TestConnectTestAuthFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	out := captureOutput(t, func() {
+		if status := connectTest([]string{server.URL}); status != sensu.CheckStateUnknown {
+			t.Errorf("expected unknown, got %d", status)
+		}
+	})
+	if out != server.URL+": authentication failed: exporter returned non OK HTTP response status: 401 Unauthorized\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// consulClient is the HTTP client used for the Consul API.
+var consulClient = &http.Client{Timeout: 10 * time.Second}
+
+// consulCatalogService is the part of an instance of a service of the Consul
+// catalog --consul-service uses.
+type consulCatalogService struct {
+	Node           string
+	Address        string
+	ServiceAddress string
+	ServicePort    int
+}
+
+// resolveConsulService builds scrape URLs for the instances of service
+// registered in the Consul catalog at addr, keeping those that have every
+// tag. The node label of each target is returned along with them.
+func resolveConsulService(addr string, token string, service string, tags []string, scheme string, path string) ([]string, map[string]model.LabelSet, error) {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	query := url.Values{}
+	for _, tag := range tags {
+		query.Add("tag", tag)
+	}
+	endpoint := strings.TrimSuffix(addr, "/") + "/v1/catalog/service/" + url.PathEscape(service)
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+	req.Header.Set("User-Agent", userAgent())
+	logger.Debug("resolving Consul service", "service", service, "tags", tags)
+	response, err := consulClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not reach Consul API: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("Consul API returned %s for service %s", response.Status, service)
+	}
+	var instances []consulCatalogService
+	if err := json.NewDecoder(response.Body).Decode(&instances); err != nil {
+		return nil, nil, fmt.Errorf("could not parse Consul service %s: %v", service, err)
+	}
+
+	targets := []string{}
+	labels := map[string]model.LabelSet{}
+	for _, instance := range instances {
+		address := instance.ServiceAddress
+		if address == "" {
+			address = instance.Address
+		}
+		target := targetURL(scheme, net.JoinHostPort(address, strconv.Itoa(instance.ServicePort)), path)
+		targets = append(targets, target)
+		labels[target] = model.LabelSet{"node": model.LabelValue(instance.Node)}
+	}
+	if len(targets) == 0 && len(tags) > 0 {
+		return nil, nil, fmt.Errorf("Consul service %s has no instances tagged %s", service, strings.Join(tags, ", "))
+	}
+	if len(targets) == 0 {
+		return nil, nil, fmt.Errorf("Consul service %s has no instances", service)
+	}
+	return targets, labels, nil
+}
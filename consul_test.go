@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestResolveConsulService(t *testing.T) {
+	setupPlugin(t, "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/catalog/service/node-exporter" || r.Header.Get("X-Consul-Token") != "consul-token" {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.Join(r.URL.Query()["tag"], ",") == "prod,metrics" {
+			fmt.Fprint(w, `[{"Node": "web-1", "Address": "10.0.0.1", "ServiceAddress": "", "ServicePort": 9100}]`)
+			return
+		}
+		fmt.Fprint(w, `[
+  {"Node": "web-1", "Address": "10.0.0.1", "ServiceAddress": "", "ServicePort": 9100},
+  {"Node": "web-2", "Address": "10.0.0.2", "ServiceAddress": "192.168.0.2", "ServicePort": 9200}
+]`)
+	}))
+	t.Cleanup(server.Close)
+
+	targets, labels, err := resolveConsulService(strings.TrimPrefix(server.URL, "http://"), "consul-token", "node-exporter", nil, "http", "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"http://10.0.0.1:9100/metrics", "http://192.168.0.2:9200/metrics"}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("expected targets %v, got %v", expected, targets)
+	}
+	if !reflect.DeepEqual(labels[expected[1]], model.LabelSet{"node": "web-2"}) {
+		t.Errorf("unexpected target labels %v", labels)
+	}
+
+	if targets, _, err := resolveConsulService(server.URL, "consul-token", "node-exporter", []string{"prod", "metrics"}, "https", "/metrics"); err != nil || len(targets) != 1 || targets[0] != "https://10.0.0.1:9100/metrics" {
+		t.Errorf("expected the tagged instance, got %v (%v)", targets, err)
+	}
+	if _, _, err := resolveConsulService(server.URL, "", "node-exporter", nil, "http", "/metrics"); err == nil {
+		t.Error("expected a denied request to be an error")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readCredentials reads basic auth credentials from path, which holds
+// user:password on its first line.
+func readCredentials(path string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("could not read credentials file %s: %v", path, err)
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	user, password, ok := strings.Cut(strings.TrimRight(line, "\r"), ":")
+	if !ok || user == "" {
+		return "", "", fmt.Errorf("credentials file %s must contain user:password", path)
+	}
+	return user, password, nil
+}
+
+// readSecret reads a secret, such as a password or a Kubernetes service
+// account token, from path, ignoring surrounding whitespace.
+func readSecret(path string, kind string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read %s file %s: %v", kind, path, err)
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("%s file %s is empty", kind, path)
+	}
+	return secret, nil
+}
+
+// credentials authenticate scrapes, either with basic auth, a bearer token or
+// a token fetched with the OAuth2 client credentials flow.
+// Secrets given as files are read again on every scrape, so that rotated
+// secrets are picked up.
+type credentials struct {
+	User            string
+	Password        string
+	PasswordFile    string
+	CredentialsFile string
+	BearerToken     string
+	BearerTokenFile string
+	NetrcFile       string
+
+	OAuth2ClientID     string
+	OAuth2ClientSecret string
+	OAuth2TokenURL     string
+	OAuth2Scopes       []string
+}
+
+// pluginCredentials returns the credentials set by the options, or by their
+// environment variables.
+func pluginCredentials() credentials {
+	return credentials{
+		User:            plugin.User,
+		Password:        plugin.Password,
+		PasswordFile:    plugin.PasswordFile,
+		CredentialsFile: plugin.CredentialsFile,
+		BearerToken:     plugin.BearerToken,
+		BearerTokenFile: plugin.BearerTokenFile,
+		NetrcFile:       netrcFile(),
+
+		OAuth2ClientID:     plugin.OAuth2ClientID,
+		OAuth2ClientSecret: plugin.OAuth2ClientSecret,
+		OAuth2TokenURL:     plugin.OAuth2TokenURL,
+		OAuth2Scopes:       plugin.OAuth2Scopes,
+	}
+}
+
+// resolve returns the user, password and bearer token to scrape target with,
+// reading the files holding them.
+func (c credentials) resolve(target string) (string, string, string, error) {
+	user, password, token := c.User, c.Password, c.BearerToken
+	var err error
+	if c.NetrcFile != "" && user == "" && c.CredentialsFile == "" {
+		host := target
+		if u, err := url.Parse(target); err == nil && u.Host != "" {
+			host = u.Hostname()
+		}
+		if user, password, err = readNetrc(c.NetrcFile, host); err != nil {
+			return "", "", "", err
+		}
+	}
+	if c.CredentialsFile != "" {
+		if user, password, err = readCredentials(c.CredentialsFile); err != nil {
+			return "", "", "", err
+		}
+	}
+	if c.PasswordFile != "" {
+		if password, err = readSecret(c.PasswordFile, "password"); err != nil {
+			return "", "", "", err
+		}
+	}
+	if c.BearerTokenFile != "" {
+		if token, err = readSecret(c.BearerTokenFile, "bearer token"); err != nil {
+			return "", "", "", err
+		}
+	}
+	return user, password, token, nil
+}
+
+// netrcFile returns the netrc file to look credentials up in: --netrc-file, or
+// ~/.netrc with --netrc, empty otherwise.
+func netrcFile() string {
+	if plugin.NetrcFile != "" || !plugin.Netrc {
+		return plugin.NetrcFile
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// readNetrc returns the login and password of the machine entry of host in
+// the netrc file at path, or of its default entry. Both are empty when no
+// entry matches.
+func readNetrc(path string, host string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("could not read netrc file %s: %v", path, err)
+	}
+
+	var user, password string
+	matched, found := false, false
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		for j := 0; j < len(fields); j++ {
+			next := ""
+			if j+1 < len(fields) {
+				next = fields[j+1]
+			}
+			switch fields[j] {
+			case "machine", "default":
+				if found {
+					return user, password, nil
+				}
+				matched = fields[j] == "default" || next == host
+				if fields[j] == "machine" {
+					j++
+				}
+				found = matched
+			case "login":
+				if matched {
+					user = next
+				}
+				j++
+			case "password":
+				if matched {
+					password = next
+				}
+				j++
+			case "account":
+				j++
+			case "macdef":
+				// A macro runs until the next empty line.
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				j = len(fields)
+			}
+		}
+	}
+	if !found {
+		logger.Debug("no netrc entry for host", "netrc", path, "host", host)
+	}
+	return user, password, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadCredentials(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "credentials")
+	if err := os.WriteFile(path, []byte("sensu:p4ss:word\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	user, password, err := readCredentials(path)
+	if err != nil || user != "sensu" || password != "p4ss:word" {
+		t.Errorf("unexpected credentials %s, %s (%v)", user, password, err)
+	}
+
+	if err := os.WriteFile(path, []byte("sensu\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readCredentials(path); err == nil {
+		t.Errorf("expected an error without a password")
+	}
+	if _, _, err := readCredentials(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+func TestReadSecret(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token")
+	if err := os.WriteFile(path, []byte("eyJhbGciOi.payload.signature\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	token, err := readSecret(path, "bearer token")
+	if err != nil || token != "eyJhbGciOi.payload.signature" {
+		t.Errorf("unexpected token %q (%v)", token, err)
+	}
+
+	if err := os.WriteFile(path, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readSecret(path, "bearer token"); err == nil {
+		t.Errorf("expected an error for an empty token")
+	}
+	if _, err := readSecret(filepath.Join(dir, "missing"), "bearer token"); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+func TestCredentialsResolve(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "password")
+	if err := os.WriteFile(path, []byte("s3cr3t\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	user, password, token, err := credentials{User: "sensu", PasswordFile: path}.resolve("http://localhost:9100/metrics")
+	if err != nil || user != "sensu" || password != "s3cr3t" || token != "" {
+		t.Errorf("unexpected credentials %s, %s, %s (%v)", user, password, token, err)
+	}
+
+	user, password, token, err = credentials{BearerTokenFile: path}.resolve("http://localhost:9100/metrics")
+	if err != nil || user != "" || password != "" || token != "s3cr3t" {
+		t.Errorf("unexpected credentials %s, %s, %s (%v)", user, password, token, err)
+	}
+
+	if _, _, _, err := (credentials{PasswordFile: filepath.Join(dir, "missing")}).resolve("http://localhost:9100/metrics"); err == nil {
+		t.Errorf("expected an error for a missing password file")
+	}
+}
+
+func TestReadNetrc(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netrc")
+	netrc := `machine node1.example.com login sensu password first
+
+macdef init
+machine node2.example.com login macro password macro
+
+machine node2.example.com
+	login monitoring
+	password second
+default login anonymous password guest
+`
+	if err := os.WriteFile(path, []byte(netrc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for host, want := range map[string]string{
+		"node1.example.com": "sensu:first",
+		"node2.example.com": "monitoring:second",
+		"node3.example.com": "anonymous:guest",
+	} {
+		user, password, err := readNetrc(path, host)
+		if err != nil || user+":"+password != want {
+			t.Errorf("unexpected credentials %s:%s for %s, want %s (%v)", user, password, host, want, err)
+		}
+	}
+
+	user, _, _, err := credentials{NetrcFile: path}.resolve("https://node1.example.com:9100/metrics")
+	if err != nil || user != "sensu" {
+		t.Errorf("expected the credentials of the target host, got %s (%v)", user, err)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+// lookupSRV resolves SRV records, replaced in tests.
+var lookupSRV = net.LookupSRV
+
+// resolveSRV looks up the SRV record name and builds a scrape URL for its
+// targets. Unless all is set only the preferred target is returned, which is
+// the first one in the priority and weight order given by net.LookupSRV.
+func resolveSRV(name string, scheme string, path string, all bool) ([]string, error) {
+	_, records, err := lookupSRV("", "", name)
+	if err != nil {
+		return nil, fmt.Errorf("SRV lookup of %s failed: %v", name, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("SRV lookup of %s returned no records", name)
+	}
+	if !all {
+		records = records[:1]
+	}
+
+	targets := []string{}
+	for _, record := range records {
+		host := net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port)))
+		targets = append(targets, targetURL(scheme, host, path))
+	}
+	return targets, nil
+}
+
+// targetURL assembles a scrape URL from its scheme, host:port and path.
+func targetURL(scheme string, host string, path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: scheme, Host: host, Path: path}).String()
+}
+
+// hostTargets builds scrape URLs for bare hosts, adding port unless the host
+// already has one. Entries that already are URLs are kept as they are.
+func hostTargets(hosts []string, scheme string, port int, path string) []string {
+	targets := []string{}
+	for _, host := range hosts {
+		if strings.Contains(host, "://") {
+			targets = append(targets, host)
+			continue
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil && port != 0 {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(port))
+		}
+		targets = append(targets, targetURL(scheme, host, path))
+	}
+	return targets
+}
+
+// addInstanceLabel sets the instance label of samples scraped from target to
+// its host:port, or to target for sockets and files, keeping any instance
+// label the exporter already exposes.
+func addInstanceLabel(samples model.Vector, target string) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return
+	}
+	instance := u.Host
+	if instance == "" {
+		instance = target
+	}
+	for _, sample := range samples {
+		if _, ok := sample.Metric[model.InstanceLabel]; !ok {
+			sample.Metric[model.InstanceLabel] = model.LabelValue(instance)
+		}
+	}
+}
+
+// fileSDGroup is a group of targets of a Prometheus file_sd file, along with
+// the labels of its targets.
+type fileSDGroup struct {
+	Targets []string          `yaml:"targets"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+// readFileSD builds scrape URLs for the targets of the file_sd file at path,
+// in JSON or YAML, and returns the labels of each. The __scheme__ and
+// __metrics_path__ labels of a group replace scheme and path for its targets,
+// and its other labels starting with __ are dropped like Prometheus does. A
+// target listed more than once is scraped once, with the labels it is first
+// listed with.
+func readFileSD(path string, scheme string, port int, metricsPath string) ([]string, map[string]model.LabelSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read targets file %s: %v", path, err)
+	}
+	var groups []fileSDGroup
+	if err := yaml.Unmarshal(data, &groups); err != nil {
+		return nil, nil, fmt.Errorf("could not parse targets file %s: %v", path, err)
+	}
+
+	targets := []string{}
+	labels := map[string]model.LabelSet{}
+	for _, group := range groups {
+		groupScheme, groupPath := scheme, metricsPath
+		set := model.LabelSet{}
+		for name, value := range group.Labels {
+			switch {
+			case name == model.SchemeLabel:
+				groupScheme = value
+			case name == model.MetricsPathLabel:
+				groupPath = value
+			case strings.HasPrefix(name, model.ReservedLabelPrefix):
+			case !model.LabelName(name).IsValidLegacy():
+				return nil, nil, fmt.Errorf("invalid label name %q in targets file %s", name, path)
+			default:
+				set[model.LabelName(name)] = model.LabelValue(value)
+			}
+		}
+		for _, target := range hostTargets(group.Targets, groupScheme, port, groupPath) {
+			if seen, ok := labels[target]; ok {
+				if !seen.Equal(set) {
+					logger.Warn("ignoring target listed again with other labels", "target", target, "labels", set, "file", path)
+				}
+				continue
+			}
+			targets = append(targets, target)
+			labels[target] = set
+		}
+	}
+	if len(targets) == 0 {
+		return nil, nil, fmt.Errorf("targets file %s lists no targets", path)
+	}
+	return targets, labels, nil
+}
+
+// addTargetLabels sets the labels of the target samples were scraped from,
+// keeping any label the exporter already exposes.
+func addTargetLabels(samples model.Vector, labels model.LabelSet) {
+	for _, sample := range samples {
+		for name, value := range labels {
+			if _, ok := sample.Metric[name]; !ok {
+				sample.Metric[name] = value
+			}
+		}
+	}
+}
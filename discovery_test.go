@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestTargetURL(t *testing.T) {
+	if got := targetURL("https", "node1:9100", "metrics"); got != "https://node1:9100/metrics" {
+		t.Errorf("unexpected URL %s", got)
+	}
+}
+
+func TestHostTargets(t *testing.T) {
+	got := hostTargets([]string{"node1", "node2:9200", "[::1]", "http://node3:9100/custom"}, "https", 9100, "/metrics")
+	expected := []string{
+		"https://node1:9100/metrics",
+		"https://node2:9200/metrics",
+		"https://[::1]:9100/metrics",
+		"http://node3:9100/custom",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d targets, got %v", len(expected), got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], got[i])
+		}
+	}
+	if got := hostTargets([]string{"node1"}, "http", 0, "metrics"); got[0] != "http://node1/metrics" {
+		t.Errorf("expected the default port of the scheme, got %s", got[0])
+	}
+}
+
+func TestAddInstanceLabel(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{"__name__": "up"}},
+		{Metric: model.Metric{"__name__": "up", "instance": "kept"}},
+	}
+	addInstanceLabel(samples, "http://node1:9100/metrics")
+	if samples[0].Metric["instance"] != "node1:9100" {
+		t.Errorf("expected instance node1:9100, got %s", samples[0].Metric["instance"])
+	}
+	if samples[1].Metric["instance"] != "kept" {
+		t.Errorf("expected existing instance label to be kept, got %s", samples[1].Metric["instance"])
+	}
+}
+
+func TestReadFileSD(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "targets.json")
+	if err := os.WriteFile(jsonPath, []byte(`[
+  {"targets": ["node1:9100", "node2"], "labels": {"env": "prod", "__meta_datacenter": "dc1"}},
+  {"targets": ["node3:9182"], "labels": {"__scheme__": "https", "__metrics_path__": "/windows/metrics", "job": "windows"}}
+]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	targets, labels, err := readFileSD(jsonPath, "http", 9100, "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"http://node1:9100/metrics", "http://node2:9100/metrics", "https://node3:9182/windows/metrics"}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("expected targets %v, got %v", expected, targets)
+	}
+	if !reflect.DeepEqual(labels["http://node2:9100/metrics"], model.LabelSet{"env": "prod"}) || !reflect.DeepEqual(labels["https://node3:9182/windows/metrics"], model.LabelSet{"job": "windows"}) {
+		t.Errorf("unexpected target labels %v", labels)
+	}
+
+	yamlPath := filepath.Join(dir, "targets.yml")
+	if err := os.WriteFile(yamlPath, []byte("- targets:\n    - node1:9100\n  labels:\n    env: staging\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if targets, labels, err := readFileSD(yamlPath, "http", 0, "/metrics"); err != nil || len(targets) != 1 || labels[targets[0]]["env"] != "staging" {
+		t.Errorf("unexpected YAML targets %v %v (%v)", targets, labels, err)
+	}
+
+	if err := os.WriteFile(yamlPath, []byte("- targets: [node1, node2]\n  labels: {env: prod}\n- targets: [node1:9100, node3]\n  labels: {env: prod}\n- targets: [node2]\n  labels: {env: staging}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	targets, labels, err = readFileSD(yamlPath, "http", 9100, "/metrics")
+	expected = []string{"http://node1:9100/metrics", "http://node2:9100/metrics", "http://node3:9100/metrics"}
+	if err != nil || !reflect.DeepEqual(targets, expected) || labels["http://node2:9100/metrics"]["env"] != "prod" {
+		t.Errorf("expected targets listed more than once to be scraped once, got %v %v (%v)", targets, labels, err)
+	}
+
+	if err := os.WriteFile(yamlPath, []byte("[]"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readFileSD(yamlPath, "http", 0, "/metrics"); err == nil {
+		t.Error("expected a file without targets to be an error")
+	}
+}
+
+func TestAddTargetLabels(t *testing.T) {
+	samples := model.Vector{{Metric: model.Metric{"__name__": "up", "env": "exporter"}}, {Metric: model.Metric{"__name__": "up"}}}
+	addTargetLabels(samples, model.LabelSet{"env": "prod", "job": "node"})
+	if samples[0].Metric["env"] != "exporter" || samples[0].Metric["job"] != "node" || samples[1].Metric["env"] != "prod" {
+		t.Errorf("unexpected labels %v", samples)
+	}
+}
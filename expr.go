@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/prometheus/common/model"
+)
+
+// exprNode is a node of a parsed --expr expression.
+type exprNode interface {
+	eval(resolve func(string) (float64, error)) (float64, error)
+}
+
+type numberNode float64
+
+type metricNode string
+
+type negateNode struct {
+	operand exprNode
+}
+
+type binaryNode struct {
+	op          byte
+	left, right exprNode
+}
+
+func (n numberNode) eval(resolve func(string) (float64, error)) (float64, error) {
+	return float64(n), nil
+}
+
+func (n metricNode) eval(resolve func(string) (float64, error)) (float64, error) {
+	return resolve(string(n))
+}
+
+func (n negateNode) eval(resolve func(string) (float64, error)) (float64, error) {
+	value, err := n.operand.eval(resolve)
+	return -value, err
+}
+
+func (n binaryNode) eval(resolve func(string) (float64, error)) (float64, error) {
+	left, err := n.left.eval(resolve)
+	if err != nil {
+		return 0, err
+	}
+	right, err := n.right.eval(resolve)
+	if err != nil {
+		return 0, err
+	}
+	switch n.op {
+	case '+':
+		return left + right, nil
+	case '-':
+		return left - right, nil
+	case '*':
+		return left * right, nil
+	default:
+		return left / right, nil
+	}
+}
+
+// exprMetrics returns the names of the metrics node refers to.
+func exprMetrics(node exprNode) []string {
+	switch n := node.(type) {
+	case metricNode:
+		return []string{string(n)}
+	case negateNode:
+		return exprMetrics(n.operand)
+	case binaryNode:
+		return append(exprMetrics(n.left), exprMetrics(n.right)...)
+	}
+	return nil
+}
+
+// exprParser is a recursive descent parser for arithmetic over metric names
+// and numbers, supporting +, -, *, / and parentheses.
+type exprParser struct {
+	input string
+	pos   int
+}
+
+// parseExpr parses an --expr expression such as
+// "http_errors_total / http_requests_total * 100".
+func parseExpr(input string) (exprNode, error) {
+	p := &exprParser{input: input}
+	node, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("invalid expression '%s': unexpected '%c' at position %d", input, p.input[p.pos], p.pos+1)
+	}
+	return node, nil
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// peek returns the next non space character, or 0 at the end of the input.
+func (p *exprParser) peek() byte {
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) parseSum() (exprNode, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseProduct() (exprNode, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseFactor() (exprNode, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, fmt.Errorf("invalid expression '%s': unexpected end", p.input)
+	case c == '-':
+		p.pos++
+		operand, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return negateNode{operand: operand}, nil
+	case c == '(':
+		p.pos++
+		node, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("invalid expression '%s': missing ')'", p.input)
+		}
+		p.pos++
+		return node, nil
+	case c == '.' || (c >= '0' && c <= '9'):
+		start := p.pos
+		for p.pos < len(p.input) && (strings.IndexByte("0123456789.eE", p.input[p.pos]) >= 0 ||
+			(strings.IndexByte("+-", p.input[p.pos]) >= 0 && strings.IndexByte("eE", p.input[p.pos-1]) >= 0)) {
+			p.pos++
+		}
+		number, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression '%s': invalid number '%s'", p.input, p.input[start:p.pos])
+		}
+		return numberNode(number), nil
+	case c == '_' || c == ':' || unicode.IsLetter(rune(c)):
+		start := p.pos
+		for p.pos < len(p.input) && isMetricNameChar(p.input[p.pos]) {
+			p.pos++
+		}
+		return metricNode(p.input[start:p.pos]), nil
+	default:
+		return nil, fmt.Errorf("invalid expression '%s': unexpected '%c' at position %d", p.input, c, p.pos+1)
+	}
+}
+
+func isMetricNameChar(c byte) bool {
+	return c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// evaluateExpr evaluates the parsed expression input, resolving every metric
+// name to the value of the single series of that name matching the label
+// matchers. The result is returned as a single sample named after input.
+func evaluateExpr(input string, expr exprNode, samples model.Vector, matchers []labelMatcher, any bool) (model.Vector, error) {
+	resolve := func(name string) (float64, error) {
+		var found *model.Sample
+		for _, sample := range samples {
+			if sample.Metric[model.MetricNameLabel] != model.LabelValue(name) || !matchLabels(sample.Metric, matchers, any) {
+				continue
+			}
+			if found != nil {
+				return 0, fmt.Errorf("metric %s of expression '%s' matches more than one series", name, input)
+			}
+			found = sample
+		}
+		if found == nil {
+			return 0, fmt.Errorf("metric %s of expression '%s' not found", name, input)
+		}
+		return float64(found.Value), nil
+	}
+
+	value, err := expr.eval(resolve)
+	if err != nil {
+		return nil, err
+	}
+	return model.Vector{{
+		Metric:    model.Metric{model.MetricNameLabel: model.LabelValue(input)},
+		Value:     model.SampleValue(value),
+		Timestamp: model.Now(),
+	}}, nil
+}
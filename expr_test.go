@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseExpr(t *testing.T) {
+	values := map[string]float64{"errors_total": 5, "requests_total": 200}
+	resolve := func(name string) (float64, error) {
+		value, ok := values[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown metric %s", name)
+		}
+		return value, nil
+	}
+
+	for input, want := range map[string]float64{
+		"errors_total / requests_total":         0.025,
+		"errors_total / requests_total * 100":   2.5,
+		"(errors_total + 5) / (requests_total)": 0.05,
+		"-errors_total + 1.5e1":                 10,
+		"requests_total - errors_total * 2":     190,
+		"errors_total * 1e-1":                   0.5,
+	} {
+		node, err := parseExpr(input)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", input, err)
+			continue
+		}
+		got, err := node.eval(resolve)
+		if err != nil || got != want {
+			t.Errorf("%s: expected %f, got %f (%v)", input, want, got, err)
+		}
+	}
+
+	for _, input := range []string{"", "errors_total /", "(errors_total", "errors_total % 2", "1..2"} {
+		if _, err := parseExpr(input); err == nil {
+			t.Errorf("%s: expected a parse error", input)
+		}
+	}
+
+	node, _ := parseExpr("missing_total + 1")
+	if _, err := node.eval(resolve); err == nil {
+		t.Errorf("expected an error for an unknown metric")
+	}
+}
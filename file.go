@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// fileTransport answers the requests for file:// URLs with the content of the
+// file, such as the output of a node exporter textfile collector or a scrape
+// saved earlier, which is decoded as the text format.
+type fileTransport struct{}
+
+func (fileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	file, err := os.Open(filePath(req.URL))
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.0",
+		ProtoMajor: 1,
+		Header:     http.Header{"Content-Type": {`text/plain; version=0.0.4`}},
+		Body:       file,
+		Request:    req,
+	}, nil
+}
+
+// filePath returns the path to the file of a file:// URL, without the slash
+// before the drive letter on Windows.
+func filePath(u *url.URL) string {
+	path := u.Path
+	if runtime.GOOS == "windows" {
+		path = strings.TrimPrefix(path, "/")
+	}
+	return filepath.FromSlash(path)
+}
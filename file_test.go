@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQueryMetricFamiliesFile(t *testing.T) {
+	setupPlugin(t, "")
+	path := filepath.Join(t.TempDir(), "textfile.prom")
+	if err := os.WriteFile(path, []byte(upMetrics), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := QueryMetricFamilies("file://"+filepath.ToSlash(path), pluginCredentials(), false, "", "", "")
+	if err != nil || len(families["up"].GetMetric()) != 3 {
+		t.Fatalf("expected the file to be decoded, got %v (%v)", families, err)
+	}
+	if _, err := QueryMetricFamilies("file://"+filepath.ToSlash(path)+".missing", pluginCredentials(), false, "", "", ""); err == nil {
+		t.Errorf("expected a missing file to be an error, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// googleScope is the scope of the tokens querying Google Cloud Managed
+// Service for Prometheus.
+const googleScope = "https://www.googleapis.com/auth/monitoring.read"
+
+// googleCredentials caches the credentials found for --google-auth during a
+// run, so that the targets share their token.
+var googleCredentials struct {
+	sync.Mutex
+	credentials *google.Credentials
+}
+
+// newGoogleTransport returns the transport authenticating the requests sent
+// with next with a token of the --google-credentials-file credentials, or of
+// the Application Default Credentials: the GOOGLE_APPLICATION_CREDENTIALS
+// file, the gcloud application default credentials file, then the service
+// account of the GCE instance or GKE workload. Tokens are fetched with client.
+func newGoogleTransport(client *http.Client, next http.RoundTripper) (http.RoundTripper, error) {
+	googleCredentials.Lock()
+	defer googleCredentials.Unlock()
+	if googleCredentials.credentials == nil {
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+		var credentials *google.Credentials
+		if plugin.GoogleCredentials != "" {
+			data, err := os.ReadFile(plugin.GoogleCredentials)
+			if err != nil {
+				return nil, fmt.Errorf("could not read Google credentials file %s: %v", plugin.GoogleCredentials, err)
+			}
+			if credentials, err = google.CredentialsFromJSON(ctx, data, googleScope); err != nil {
+				return nil, fmt.Errorf("invalid Google credentials file %s: %v", plugin.GoogleCredentials, err)
+			}
+		} else {
+			var err error
+			if credentials, err = google.FindDefaultCredentials(ctx, googleScope); err != nil {
+				return nil, fmt.Errorf("no Google credentials found for --google-auth: %v", err)
+			}
+		}
+		googleCredentials.credentials = credentials
+	}
+	return &oauth2.Transport{Source: googleCredentials.credentials.TokenSource, Base: next}, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// googleServer returns the URL of a server recording the Authorization header
+// of the requests it receives in authorization.
+func googleServer(t *testing.T, authorization *string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*authorization = r.Header.Get("Authorization")
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestQueryMetricFamiliesGoogleServiceAccount(t *testing.T) {
+	setupPlugin(t, "")
+	t.Cleanup(func() { googleCredentials.credentials = nil })
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.FormValue("assertion"), ".")
+		if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || len(parts) != 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		var decoded map[string]any
+		json.Unmarshal(claims, &decoded)
+		w.Header().Set("Content-Type", "application/json")
+		if rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature) != nil || decoded["iss"] != "sensu@project.iam.gserviceaccount.com" || decoded["scope"] != googleScope {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid_grant"}`)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"ya29.token","expires_in":3599,"token_type":"Bearer"}`)
+	}))
+	t.Cleanup(tokenServer.Close)
+
+	credentials, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "sensu@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    tokenServer.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin.GoogleAuth = true
+	plugin.GoogleCredentials = filepath.Join(t.TempDir(), "key.json")
+	if err := os.WriteFile(plugin.GoogleCredentials, credentials, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var authorization string
+	if _, err := QueryMetricFamilies(googleServer(t, &authorization), pluginCredentials(), false, "", "", ""); err != nil || authorization != "Bearer ya29.token" {
+		t.Errorf("expected the token of the service account, got %q (%v)", authorization, err)
+	}
+}
+
+func TestQueryMetricFamiliesGoogleExternalAccount(t *testing.T) {
+	setupPlugin(t, "")
+	t.Cleanup(func() { googleCredentials.credentials = nil })
+	dir := t.TempDir()
+	subjectToken := filepath.Join(dir, "token")
+	if err := os.WriteFile(subjectToken, []byte("oidc-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:token-exchange" || r.FormValue("subject_token") != "oidc-token" || r.FormValue("scope") != googleScope {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_request"}`)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"ya29.federated","issued_token_type":"urn:ietf:params:oauth:token-type:access_token","token_type":"Bearer","expires_in":3600}`)
+	}))
+	t.Cleanup(stsServer.Close)
+
+	credentials, err := json.Marshal(map[string]any{
+		"type":               "external_account",
+		"audience":           "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/sensu/providers/oidc",
+		"subject_token_type": "urn:ietf:params:oauth:token-type:jwt",
+		"token_url":          stsServer.URL,
+		"credential_source":  map[string]string{"file": subjectToken},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "credentials.json")
+	if err := os.WriteFile(path, credentials, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+	plugin.GoogleAuth = true
+	var authorization string
+	if _, err := QueryMetricFamilies(googleServer(t, &authorization), pluginCredentials(), false, "", "", ""); err != nil || authorization != "Bearer ya29.federated" {
+		t.Errorf("expected the token of the workload identity federation, got %q (%v)", authorization, err)
+	}
+}
+
+func TestQueryMetricFamiliesGoogleMetadata(t *testing.T) {
+	setupPlugin(t, "")
+	t.Cleanup(func() { googleCredentials.credentials = nil })
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+	t.Setenv("HOME", t.TempDir())
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" || r.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"ya29.metadata","expires_in":3599,"token_type":"Bearer"}`)
+	}))
+	t.Cleanup(metadata.Close)
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(metadata.URL, "http://"))
+
+	plugin.GoogleAuth = true
+	var authorization string
+	if _, err := QueryMetricFamilies(googleServer(t, &authorization), pluginCredentials(), false, "", "", ""); err != nil || authorization != "Bearer ya29.metadata" {
+		t.Errorf("expected the token of the metadata server, got %q (%v)", authorization, err)
+	}
+}
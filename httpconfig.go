@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/common/config"
+)
+
+// loadHTTPConfig reads the Prometheus HTTP client configuration of path, as
+// used in scrape configs, which configures the client instead of the TLS,
+// authentication and proxy options. Setting one of them too is an error.
+func loadHTTPConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read HTTP config file %s: %v", path, err)
+	}
+	cfg, err := config.LoadHTTPConfig(string(data))
+	if err != nil {
+		return fmt.Errorf("could not parse HTTP config file %s: %v", path, err)
+	}
+	cfg.SetDirectory(filepath.Dir(path))
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid HTTP config file %s: %v", path, err)
+	}
+
+	var conflicts []string
+	for option, set := range map[string]bool{
+		"--user":               plugin.User != "",
+		"--password":           plugin.Password != "",
+		"--password-file":      plugin.PasswordFile != "",
+		"--credentials-file":   plugin.CredentialsFile != "",
+		"--netrc":              plugin.Netrc || plugin.NetrcFile != "",
+		"--bearer-token":       plugin.BearerToken != "" || plugin.BearerTokenFile != "",
+		"--oauth2-client-id":   plugin.OAuth2ClientID != "",
+		"--cert":               plugin.Cert != "" || plugin.Key != "",
+		"--cacert":             plugin.CaCert != "",
+		"--servername":         plugin.ServerName != "",
+		"--insecureskipverify": plugin.insecureSkipVerify,
+		"--tls-min-version":    plugin.TLSMinVersion != "",
+		"--tls-ciphers":        len(plugin.TLSCiphers) > 0,
+		"--proxy-url":          plugin.ProxyUrl != "",
+		"--socks5":             plugin.Socks5 != "" && (cfg.ProxyURL.URL != nil || cfg.ProxyFromEnvironment),
+	} {
+		if set {
+			conflicts = append(conflicts, option)
+		}
+	}
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return fmt.Errorf("%s can't be used with the HTTP config file %s", strings.Join(conflicts, ", "), path)
+	}
+	plugin.httpConfig = cfg
+	return nil
+}
+
+// newHTTPConfigTransport returns the transport of the --http-config-file
+// configuration, dialing with dial.
+func newHTTPConfigTransport(dial config.DialContextFunc) (http.RoundTripper, error) {
+	return config.NewRoundTripperFromConfig(*plugin.httpConfig, "sensu-prometheus-metrics-checks", config.WithDialContextFunc(dial))
+}
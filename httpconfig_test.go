@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadHTTPConfig(t *testing.T) {
+	setupPlugin(t, "")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "http.yml")
+	config := `authorization:
+  credentials_file: token
+tls_config:
+  ca_file: /etc/ssl/ca.pem
+  server_name: node.example.com
+  min_version: TLS12
+oauth2:
+  client_id: sensu
+  token_url: https://sso.example.com/token
+  endpoint_params:
+    audience: metrics
+proxy_url: http://proxy.example.com:3128
+http_headers:
+  X-Scope-OrgID:
+    values: [team-a]
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadHTTPConfig(path); err == nil || !strings.Contains(err.Error(), "at most one of basic_auth, oauth2 & authorization") {
+		t.Errorf("expected the config to be validated, got %v", err)
+	}
+	config = strings.Replace(config, "oauth2:\n  client_id: sensu\n  token_url: https://sso.example.com/token\n  endpoint_params:\n    audience: metrics\n", "", 1)
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadHTTPConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	cfg := plugin.httpConfig
+	if cfg.Authorization.Type != "Bearer" || cfg.Authorization.CredentialsFile != filepath.Join(dir, "token") {
+		t.Errorf("unexpected authorization %+v", cfg.Authorization)
+	}
+	if cfg.TLSConfig.CAFile != "/etc/ssl/ca.pem" || cfg.TLSConfig.ServerName != "node.example.com" || cfg.TLSConfig.MinVersion.String() != "TLS12" {
+		t.Errorf("unexpected TLS config %+v", cfg.TLSConfig)
+	}
+	if cfg.ProxyURL.String() != "http://proxy.example.com:3128" || !cfg.FollowRedirects || !cfg.EnableHTTP2 {
+		t.Errorf("unexpected proxy %s, follow_redirects %v and enable_http2 %v", cfg.ProxyURL.String(), cfg.FollowRedirects, cfg.EnableHTTP2)
+	}
+
+	plugin.httpConfig = nil
+	plugin.Cert, plugin.ProxyUrl = "/etc/ssl/cert.pem", "http://other.example.com:3128"
+	if err := loadHTTPConfig(path); err == nil || !strings.Contains(err.Error(), "--cert, --proxy-url can't be used") {
+		t.Errorf("expected options configuring the client to be rejected, got %v", err)
+	}
+	plugin.Cert, plugin.ProxyUrl = "", ""
+
+	for _, config := range []string{"authorization:\n  type: Basic\n", "unknown: true\n", "tls_config:\n  min_version: TLS14\n", "proxy_url: http://proxy.example.com:3128\nproxy_from_environment: true\n"} {
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := loadHTTPConfig(path); err == nil {
+			t.Errorf("expected %q to be rejected", config)
+		}
+	}
+}
+
+func TestQueryMetricFamiliesHTTPConfig(t *testing.T) {
+	setupPlugin(t, "")
+	var request *http.Request
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+		fmt.Fprint(w, upMetrics)
+	}))
+	t.Cleanup(server.Close)
+	dir := t.TempDir()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(filepath.Join(dir, "ca.pem"), ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "token"), []byte("s3cr3t\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "http.yml")
+	config := `authorization:
+  credentials_file: token
+tls_config:
+  ca_file: ca.pem
+  server_name: example.com
+  min_version: TLS12
+http_headers:
+  X-Scope-OrgID:
+    values: [team-a]
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadHTTPConfig(path); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := QueryMetricFamilies(server.URL, pluginCredentials(), false, "", "", "")
+	if err != nil || len(families["up"].GetMetric()) != 3 {
+		t.Fatalf("expected the scrape to use the TLS config, got %v (%v)", families, err)
+	}
+	if request.Header.Get("Authorization") != "Bearer s3cr3t" || request.Header.Get("X-Scope-OrgID") != "team-a" {
+		t.Errorf("unexpected headers %v", request.Header)
+	}
+}
+
+func TestQueryMetricFamiliesHTTPConfigFollowRedirects(t *testing.T) {
+	setupPlugin(t, upMetrics)
+	target := plugin.Urls[0]
+	server := httptest.NewServer(http.RedirectHandler(target, http.StatusFound))
+	t.Cleanup(server.Close)
+	path := filepath.Join(t.TempDir(), "http.yml")
+
+	for _, tc := range []struct {
+		config string
+		follow bool
+	}{
+		{"enable_http2: true\n", true},
+		{"follow_redirects: false\n", false},
+	} {
+		if err := os.WriteFile(path, []byte(tc.config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := loadHTTPConfig(path); err != nil {
+			t.Fatal(err)
+		}
+		_, err := QueryMetricFamilies(server.URL, pluginCredentials(), false, "", "", "")
+		var statusError *StatusError
+		if tc.follow && err != nil {
+			t.Errorf("expected redirects to be followed by default, got %v", err)
+		} else if !tc.follow && (!errors.As(err, &statusError) || statusError.StatusCode != http.StatusFound) {
+			t.Errorf("expected the redirect to be returned, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+// partialResults tracks the scrapes and the evaluation so far, to report them
+// when the check is interrupted before it completes.
+type partialResults struct {
+	mu        sync.Mutex
+	scraped   int
+	targets   int
+	evaluated int
+	total     int
+	failures  []failure
+}
+
+var progress = &partialResults{}
+
+// scraping starts tracking the scrapes of targets.
+func (p *partialResults) scraping(targets int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.scraped, p.targets = 0, targets
+}
+
+// scrapedTarget records that the scrape of one more target completed.
+func (p *partialResults) scrapedTarget() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.scraped += 1
+}
+
+// record stores how many of total series were evaluated and the failures
+// found. Only the slice is kept, the evaluation appends to failures without
+// changing the failures it holds already.
+func (p *partialResults) record(failures []failure, evaluated int, total int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures = failures
+	p.evaluated, p.total = evaluated, total
+}
+
+// report prints the results recorded so far and returns the state to exit
+// with, the worst of state and the failures found. They are written straight
+// to stdout, as a JSON report with --output json, since the check may still
+// be collecting its own output.
+func (p *partialResults) report(state int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var lines []string
+	switch {
+	case p.total == 0 && p.targets > 0:
+		lines = []string{fmt.Sprintf("Interrupted before any series was evaluated, %d of %d targets scraped", p.scraped, p.targets)}
+	case p.total == 0:
+		lines = []string{"Interrupted before any series was evaluated"}
+	default:
+		lines = append([]string{fmt.Sprintf("Interrupted, partial results of %d of %d series", p.evaluated, p.total)}, failureLines(p.failures, plugin.MaxFailures)...)
+		for _, failure := range p.failures {
+			state = worstState(state, failure.State)
+		}
+	}
+	if plugin.Output == "json" {
+		data, err := json.Marshal(checkReport{Status: state, Thresholds: reportThresholds(), Series: []seriesReport{}, Messages: lines})
+		if err != nil {
+			fmt.Println(strings.Join(lines, "\n"))
+			return sensu.CheckStateUnknown
+		}
+		fmt.Println(string(data))
+		return state
+	}
+	fmt.Println(strings.Join(lines, "\n"))
+	return state
+}
+
+// handleInterrupts makes SIGTERM and SIGINT print the partial results and
+// exit with --interrupt-state, instead of dying without any output.
+func handleInterrupts() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-signals
+		os.Exit(progress.report(checkStates[plugin.InterruptState]))
+	}()
+}
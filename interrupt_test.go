@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+func TestPartialResultsReport(t *testing.T) {
+	p := &partialResults{}
+	var state int
+	output := captureOutput(t, func() { state = p.report(sensu.CheckStateUnknown) })
+	if state != sensu.CheckStateUnknown || output != "Interrupted before any series was evaluated\n" {
+		t.Errorf("unexpected report %d %q", state, output)
+	}
+
+	p.scraping(3)
+	p.scrapedTarget()
+	output = captureOutput(t, func() { state = p.report(sensu.CheckStateUnknown) })
+	if output != "Interrupted before any series was evaluated, 1 of 3 targets scraped\n" {
+		t.Errorf("unexpected report %q", output)
+	}
+
+	failures := []failure{{sensu.CheckStateCritical, "Metric up is at 0", 0}}
+	p.record(failures, 2, 5)
+	failures = append(failures, failure{sensu.CheckStateCritical, "Metric up is at 1", 0})
+	output = captureOutput(t, func() { state = p.report(sensu.CheckStateWarning) })
+	if state != sensu.CheckStateCritical || output != "Interrupted, partial results of 2 of 5 series\nMetric up is at 0\n" {
+		t.Errorf("unexpected report %d %q", state, output)
+	}
+}
+
+func TestPartialResultsReportJSON(t *testing.T) {
+	setupPlugin(t, "")
+	plugin.Output = "json"
+	plugin.Min = 1
+	p := &partialResults{}
+	p.record([]failure{{sensu.CheckStateCritical, "Metric up is at 0", 0}}, 2, 5)
+
+	var state int
+	output := captureOutput(t, func() { state = p.report(sensu.CheckStateWarning) })
+	var result checkReport
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatalf("expected a single JSON document, got %q (%v)", output, err)
+	}
+	if state != sensu.CheckStateCritical || result.Status != sensu.CheckStateCritical || result.Thresholds["min"] != 1.0 {
+		t.Errorf("unexpected report %d %+v", state, result)
+	}
+	if len(result.Messages) != 2 || result.Messages[0] != "Interrupted, partial results of 2 of 5 series" || result.Messages[1] != "Metric up is at 0" {
+		t.Errorf("unexpected messages %q", result.Messages)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// kubeServiceAccountDir holds the credentials Kubernetes mounts into pods,
+// replaced by tests.
+var kubeServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubeEndpointSlices is the part of an EndpointSliceList --kube-service uses.
+type kubeEndpointSlices struct {
+	Items []struct {
+		Ports     []kubeEndpointPort `json:"ports"`
+		Endpoints []struct {
+			Addresses  []string `json:"addresses"`
+			Conditions struct {
+				Ready *bool `json:"ready"`
+			} `json:"conditions"`
+			TargetRef *struct {
+				Kind string `json:"kind"`
+				Name string `json:"name"`
+			} `json:"targetRef"`
+		} `json:"endpoints"`
+	} `json:"items"`
+}
+
+// kubeEndpointPort is a port of an EndpointSlice.
+type kubeEndpointPort struct {
+	Name *string `json:"name"`
+	Port *int    `json:"port"`
+}
+
+// resolveKubeService builds scrape URLs for the ready endpoints of the
+// service, given as namespace/name or as name in the namespace of the pod the
+// check runs in, with the in-cluster credentials of the pod. It scrapes port,
+// a port name or number, or the only port of the service, or its port named
+// metrics, when port is empty. The namespace and pod labels of each target
+// are returned along with them.
+func resolveKubeService(service string, port string, scheme string, path string) ([]string, map[string]model.LabelSet, error) {
+	namespace, name, ok := strings.Cut(service, "/")
+	if !ok {
+		data, err := os.ReadFile(filepath.Join(kubeServiceAccountDir, "namespace"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not find the namespace of --kube-service %s: %v", service, err)
+		}
+		namespace, name = strings.TrimSpace(string(data)), service
+	}
+	client, apiURL, token, err := kubeClient()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	endpoint := fmt.Sprintf("%s/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices?labelSelector=%s", apiURL, url.PathEscape(namespace), url.QueryEscape("kubernetes.io/service-name="+name))
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent())
+	logger.Debug("resolving Kubernetes service", "namespace", namespace, "service", name)
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not reach the Kubernetes API: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("Kubernetes API returned %s for the endpoints of service %s/%s", response.Status, namespace, name)
+	}
+	var slices kubeEndpointSlices
+	if err := json.NewDecoder(response.Body).Decode(&slices); err != nil {
+		return nil, nil, fmt.Errorf("could not parse the endpoints of service %s/%s: %v", namespace, name, err)
+	}
+
+	targets := []string{}
+	labels := map[string]model.LabelSet{}
+	for _, slice := range slices.Items {
+		number := kubePort(slice.Ports, port)
+		if number == 0 {
+			return nil, nil, fmt.Errorf("service %s/%s has no port %q, set --kube-port", namespace, name, port)
+		}
+		for _, endpoint := range slice.Endpoints {
+			if ready := endpoint.Conditions.Ready; ready != nil && !*ready {
+				continue
+			}
+			set := model.LabelSet{"namespace": model.LabelValue(namespace)}
+			if ref := endpoint.TargetRef; ref != nil && ref.Kind == "Pod" {
+				set["pod"] = model.LabelValue(ref.Name)
+			}
+			for _, address := range endpoint.Addresses {
+				target := targetURL(scheme, net.JoinHostPort(address, strconv.Itoa(number)), path)
+				targets = append(targets, target)
+				labels[target] = set
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return nil, nil, fmt.Errorf("service %s/%s has no ready endpoints", namespace, name)
+	}
+	return targets, labels, nil
+}
+
+// kubePort returns the number of port among the ports of an EndpointSlice, 0
+// when it has no such port.
+func kubePort(ports []kubeEndpointPort, port string) int {
+	if number, err := strconv.Atoi(port); err == nil {
+		return number
+	}
+	for _, candidate := range ports {
+		if candidate.Port == nil {
+			continue
+		}
+		name := ""
+		if candidate.Name != nil {
+			name = *candidate.Name
+		}
+		if name == port || (port == "" && (len(ports) == 1 || name == "metrics")) {
+			return *candidate.Port
+		}
+	}
+	return 0
+}
+
+// kubeClient returns a client of the Kubernetes API the check runs in, its
+// URL and the token of the service account of the pod.
+func kubeClient() (*http.Client, string, string, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, "", "", errors.New("--kube-service requires running in a Kubernetes pod, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	token, err := os.ReadFile(filepath.Join(kubeServiceAccountDir, "token"))
+	if err != nil {
+		return nil, "", "", fmt.Errorf("could not read the Kubernetes service account token: %v", err)
+	}
+	ca, err := os.ReadFile(filepath.Join(kubeServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, "", "", fmt.Errorf("could not read the Kubernetes CA: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca)
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+	}
+	return client, "https://" + net.JoinHostPort(host, port), strings.TrimSpace(string(token)), nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestResolveKubeService(t *testing.T) {
+	setupPlugin(t, "")
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/discovery.k8s.io/v1/namespaces/monitoring/endpointslices" || r.URL.Query().Get("labelSelector") != "kubernetes.io/service-name=node-exporter" || r.Header.Get("Authorization") != "Bearer kube-token" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"items": [{
+  "ports": [{"name": "http", "port": 8080}, {"name": "metrics", "port": 9100}],
+  "endpoints": [
+    {"addresses": ["10.0.0.1"], "conditions": {"ready": true}, "targetRef": {"kind": "Pod", "name": "node-exporter-a"}},
+    {"addresses": ["10.0.0.2"], "conditions": {"ready": false}, "targetRef": {"kind": "Pod", "name": "node-exporter-b"}},
+    {"addresses": ["10.0.0.3"], "conditions": {}, "targetRef": {"kind": "Pod", "name": "node-exporter-c"}}
+  ]
+}]}`)
+	}))
+	t.Cleanup(server.Close)
+
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBERNETES_SERVICE_HOST", host)
+	t.Setenv("KUBERNETES_SERVICE_PORT", port)
+	saved := kubeServiceAccountDir
+	t.Cleanup(func() { kubeServiceAccountDir = saved })
+	kubeServiceAccountDir = t.TempDir()
+	for name, content := range map[string][]byte{
+		"token":     []byte("kube-token\n"),
+		"namespace": []byte("monitoring"),
+		"ca.crt":    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}),
+	} {
+		if err := os.WriteFile(filepath.Join(kubeServiceAccountDir, name), content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	targets, labels, err := resolveKubeService("node-exporter", "", "http", "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"http://10.0.0.1:9100/metrics", "http://10.0.0.3:9100/metrics"}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("expected the ready endpoints on the metrics port %v, got %v", expected, targets)
+	}
+	if !reflect.DeepEqual(labels[targets[1]], model.LabelSet{"namespace": "monitoring", "pod": "node-exporter-c"}) {
+		t.Errorf("unexpected target labels %v", labels)
+	}
+
+	if targets, _, err := resolveKubeService("monitoring/node-exporter", "http", "http", "/metrics"); err != nil || targets[0] != "http://10.0.0.1:8080/metrics" {
+		t.Errorf("expected the endpoints on the http port, got %v (%v)", targets, err)
+	}
+	if _, _, err := resolveKubeService("monitoring/node-exporter", "debug", "http", "/metrics"); err == nil {
+		t.Error("expected a missing port to be an error")
+	}
+	if _, _, err := resolveKubeService("default/node-exporter", "", "http", "/metrics"); err == nil {
+		t.Error("expected a missing service to be an error")
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// labelMatcher selects series whose label Name has one of Values, ignoring
+// the case of values when CaseInsensitive is set.
+type labelMatcher struct {
+	Name            model.LabelName
+	Values          []model.LabelValue
+	CaseInsensitive bool
+}
+
+// parseLabelMatchers parses --label specs of the form name:value. An empty
+// value, as in name:, selects series without the label, since Prometheus
+// treats an empty label the same as an absent one. A value of @path reads the
+// accepted values from the file at path, one per line, so the file is read
+// again on every run. With caseInsensitive set label values are
+// compared regardless of case, label names always have to match exactly.
+func parseLabelMatchers(specs []string, caseInsensitive bool) ([]labelMatcher, error) {
+	matchers := []labelMatcher{}
+	for _, spec := range specs {
+		labelName, labelValue, err := splitLabelSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		matcher := labelMatcher{Name: model.LabelName(labelName), CaseInsensitive: caseInsensitive}
+		if path, ok := strings.CutPrefix(labelValue, "@"); ok {
+			values, err := readLabelValues(path)
+			if err != nil {
+				return nil, err
+			}
+			matcher.Values = values
+		} else {
+			matcher.Values = []model.LabelValue{model.LabelValue(labelValue)}
+		}
+		matchers = append(matchers, matcher)
+	}
+	return matchers, nil
+}
+
+// validateLabelSpecs checks that every --label spec is of the form name:value
+// with a valid label name.
+func validateLabelSpecs(specs []string) error {
+	for _, spec := range specs {
+		if _, _, err := splitLabelSpec(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitLabelSpec splits a --label spec into its label name and value.
+func splitLabelSpec(spec string) (string, string, error) {
+	labelSplit := strings.SplitN(spec, ":", 2)
+	if len(labelSplit) != 2 {
+		return "", "", fmt.Errorf("invalid label spec '%s', expected name:value", spec)
+	}
+	labelName := strings.TrimSpace(labelSplit[0])
+	labelValue := strings.TrimSpace(labelSplit[1])
+	if !model.LabelName(labelName).IsValidLegacy() {
+		return "", "", fmt.Errorf("invalid label spec '%s', '%s' is not a valid label name", spec, labelName)
+	}
+	return labelName, labelValue, nil
+}
+
+// readLabelValues reads the label values listed in path, one per line. Blank
+// lines and lines starting with # are ignored.
+func readLabelValues(path string) ([]model.LabelValue, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read label values file %s: %v", path, err)
+	}
+	defer file.Close()
+
+	values := []model.LabelValue{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		values = append(values, model.LabelValue(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read label values file %s: %v", path, err)
+	}
+	return values, nil
+}
+
+// matches reports whether metric carries the label with an accepted value.
+func (m labelMatcher) matches(metric model.Metric) bool {
+	for _, value := range m.Values {
+		if metric[m.Name] == value {
+			return true
+		}
+		if m.CaseInsensitive && strings.EqualFold(string(metric[m.Name]), string(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchLabels reports whether metric satisfies every matcher, or at least one
+// of them when any is set. Without matchers every metric matches.
+func matchLabels(metric model.Metric, matchers []labelMatcher, any bool) bool {
+	matchLabel := 0
+	for _, matcher := range matchers {
+		if matcher.matches(metric) {
+			matchLabel += 1
+		}
+	}
+	if any && len(matchers) > 0 {
+		return matchLabel > 0
+	}
+	return matchLabel == len(matchers)
+}
+
+// parseRequiredLabels parses --require-labels specs of the form
+// name=value1,value2. The flag splits its values on commas, so entries
+// without a = add to the values of the previous spec.
+func parseRequiredLabels(specs []string) ([]labelMatcher, error) {
+	required := []labelMatcher{}
+	for _, spec := range specs {
+		labelName, values, ok := strings.Cut(spec, "=")
+		if !ok {
+			if len(required) == 0 {
+				return nil, fmt.Errorf("invalid required labels '%s', expected name=value1,value2", spec)
+			}
+			last := &required[len(required)-1]
+			last.Values = append(last.Values, splitLabelValues(spec)...)
+			continue
+		}
+		labelName = strings.TrimSpace(labelName)
+		if !model.LabelName(labelName).IsValidLegacy() {
+			return nil, fmt.Errorf("invalid required labels '%s', '%s' is not a valid label name", spec, labelName)
+		}
+		required = append(required, labelMatcher{Name: model.LabelName(labelName), Values: splitLabelValues(values)})
+	}
+	return required, nil
+}
+
+// splitLabelValues splits a comma separated list of label values, dropping
+// empty ones.
+func splitLabelValues(list string) []model.LabelValue {
+	values := []model.LabelValue{}
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, model.LabelValue(value))
+		}
+	}
+	return values
+}
+
+// missingLabelValues returns the required label values that no sample
+// carries, formatted as name=value.
+func missingLabelValues(samples model.Vector, required []labelMatcher) []string {
+	missing := []string{}
+	for _, labels := range required {
+		for _, value := range labels.Values {
+			found := false
+			for _, sample := range samples {
+				if sample.Metric[labels.Name] == value {
+					found = true
+					break
+				}
+			}
+			if !found {
+				missing = append(missing, fmt.Sprintf("%s=%s", labels.Name, value))
+			}
+		}
+	}
+	return missing
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestParseLabelMatchers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowed")
+	if err := os.WriteFile(path, []byte("node1\n# retired\n\nnode2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	matchers, err := parseLabelMatchers([]string{"job: node", "instance:@" + path}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for metric, want := range map[string]bool{
+		"node1": true,
+		"node2": true,
+		"node3": false,
+	} {
+		m := model.Metric{"job": "node", "instance": model.LabelValue(metric)}
+		if got := matchLabels(m, matchers, false); got != want {
+			t.Errorf("instance %s: expected match %t, got %t", metric, want, got)
+		}
+	}
+	if matchLabels(model.Metric{"job": "other", "instance": "node1"}, matchers, false) {
+		t.Errorf("expected job other not to match")
+	}
+}
+
+func TestParseLabelMatchersMissingFile(t *testing.T) {
+	if _, err := parseLabelMatchers([]string{"instance:@" + filepath.Join(t.TempDir(), "missing")}, false); err == nil {
+		t.Errorf("expected an error for a missing label values file")
+	}
+}
+
+func TestParseLabelMatchersCaseInsensitive(t *testing.T) {
+	metric := model.Metric{"instance": "Prod-01"}
+
+	matchers, err := parseLabelMatchers([]string{"instance:prod-01"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matchLabels(metric, matchers, false) {
+		t.Errorf("expected case sensitive matching by default")
+	}
+
+	matchers, err = parseLabelMatchers([]string{"instance:prod-01"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matchLabels(metric, matchers, false) {
+		t.Errorf("expected case insensitive value matching")
+	}
+
+	matchers, err = parseLabelMatchers([]string{"Instance:prod-01"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matchLabels(metric, matchers, false) {
+		t.Errorf("expected label names to stay case sensitive")
+	}
+}
+
+func TestMatchLabelsAny(t *testing.T) {
+	matchers, err := parseLabelMatchers([]string{"job:node", "instance:node1"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		metric model.Metric
+		all    bool
+		any    bool
+	}{
+		{model.Metric{"job": "node", "instance": "node1"}, true, true},
+		{model.Metric{"job": "node", "instance": "node2"}, false, true},
+		{model.Metric{"job": "other", "instance": "node1"}, false, true},
+		{model.Metric{"job": "other", "instance": "node2"}, false, false},
+	} {
+		if got := matchLabels(test.metric, matchers, false); got != test.all {
+			t.Errorf("%s: expected all match %t, got %t", test.metric, test.all, got)
+		}
+		if got := matchLabels(test.metric, matchers, true); got != test.any {
+			t.Errorf("%s: expected any match %t, got %t", test.metric, test.any, got)
+		}
+	}
+
+	if !matchLabels(model.Metric{"job": "other"}, nil, true) {
+		t.Errorf("expected any match without matchers to match every metric")
+	}
+}
+
+func TestParseLabelMatchersAbsent(t *testing.T) {
+	matchers, err := parseLabelMatchers([]string{"replica:"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matchLabels(model.Metric{"job": "node"}, matchers, false) {
+		t.Errorf("expected a series without the replica label to match")
+	}
+	if matchLabels(model.Metric{"job": "node", "replica": "a"}, matchers, false) {
+		t.Errorf("expected a series with the replica label not to match")
+	}
+
+	if _, err := parseLabelMatchers([]string{"replica"}, false); err == nil {
+		t.Errorf("expected an error for a label spec without a colon")
+	}
+}
+
+func TestValidateLabelSpecs(t *testing.T) {
+	if err := validateLabelSpecs([]string{"job:node", "replica:", "instance:@/etc/allowed"}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	err := validateLabelSpecs([]string{"job:node", "foo"})
+	if err == nil || err.Error() != "invalid label spec 'foo', expected name:value" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := validateLabelSpecs([]string{"my-label:x"}); err == nil {
+		t.Errorf("expected an error for an invalid label name")
+	}
+}
+
+func TestParseRequiredLabels(t *testing.T) {
+	required, err := parseRequiredLabels([]string{"instance=node1", "node2", "job=node"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(required) != 2 || len(required[0].Values) != 2 || required[0].Values[1] != "node2" || required[1].Name != "job" {
+		t.Errorf("unexpected required labels %v", required)
+	}
+	if _, err := parseRequiredLabels([]string{"node1"}); err == nil {
+		t.Errorf("expected an error without a label name")
+	}
+}
+
+func TestMissingLabelValues(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{"instance": "node1"}},
+		{Metric: model.Metric{"instance": "node3"}},
+	}
+	missing := missingLabelValues(samples, []labelMatcher{{Name: "instance", Values: []model.LabelValue{"node1", "node2", "node3"}}})
+	if len(missing) != 1 || missing[0] != "instance=node2" {
+		t.Errorf("expected instance=node2 to be missing, got %v", missing)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/prometheus/common/promslog"
+)
+
+// logger writes diagnostic logs to stderr, keeping them apart from the check
+// output on stdout. It discards everything until checkArgs configures it.
+var logger = promslog.NewNopLogger()
+
+// newLogger returns a logger filtering out entries below level, writing
+// logfmt lines with the text format or JSON objects with the json format.
+func newLogger(level string, format string) (*slog.Logger, error) {
+	allowedLevel := promslog.NewLevel()
+	if err := allowedLevel.Set(level); err != nil {
+		return nil, err
+	}
+	allowedFormat := promslog.NewFormat()
+	if format == "json" {
+		if err := allowedFormat.Set(format); err != nil {
+			return nil, err
+		}
+	}
+	return promslog.New(&promslog.Config{Level: allowedLevel, Format: allowedFormat}), nil
+}
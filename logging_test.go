@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	text, err := newLogger("info", "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := text.Handler().(*slog.TextHandler); !ok {
+		t.Errorf("expected a text handler, got %T", text.Handler())
+	}
+	json, err := newLogger("debug", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := json.Handler().(*slog.JSONHandler); !ok {
+		t.Errorf("expected a JSON handler, got %T", json.Handler())
+	}
+	if _, err := newLogger("verbose", "text"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
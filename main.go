@@ -1,27 +1,40 @@
 package main
 
 import (
+	"compress/gzip"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"text/template"
 	"time"
 
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/config"
 	"github.com/prometheus/common/expfmt"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/common/promslog"
 	corev2 "github.com/sensu/core/v2"
 	"github.com/sensu/sensu-plugin-sdk/sensu"
 )
 
+// defaultURL is scraped when no target is given.
+const defaultURL = "http://localhost:9182/metrics"
+
 // Config represents the check plugin config.
 type Config struct {
 	sensu.PluginConfig
-	Url                string
-	Metric             string
+	Urls               []string
+	Metrics            []string
 	Min                float64
 	Max                float64
 	Value              float64
@@ -32,6 +45,137 @@ type Config struct {
 	Key                string
 	CaCert             string
 	insecureSkipVerify bool
+	httpConfig         *config.HTTPClientConfig
+	Aggregate          string
+	GroupBy            []string
+	MinHealthy         int
+	EmptyState         string
+	Srv                string
+	SrvAll             bool
+	Scheme             string
+	Path               string
+	MaxFailures        int
+	CheckUp            bool
+	StateFile          string
+	DeltaMin           float64
+	DeltaMax           float64
+	UrlsFile           string
+	Concurrency        int
+	Scale              float64
+	Unit               string
+	DuplicateState     string
+	ConnectTest        bool
+	LabelCI            bool
+	MaxAge             int
+	MissingState       string
+	StaleState         string
+	NaNState           string
+	ExpectType         string
+	AgeOf              bool
+	Quantile           float64
+	LabelMatch         string
+	LogLevel           string
+	ConnectTimeout     int
+	Expr               string
+	OutputLabels       []string
+	CredentialsFile    string
+	RequireChange      bool
+	WorstOnly          bool
+	Hosts              []string
+	Port               int
+	Tolerance          float64
+	RequireLabels      []string
+	FallbackUrl        string
+	Perfdata           bool
+	Excludes           []string
+	UserAgent          string
+	ActiveWindow       string
+	Timezone           string
+	InactiveState      string
+	FailFast           bool
+	MetricPrefix       string
+	MetricSuffix       string
+	CardinalityBy      string
+	CountMax           int
+	ServerName         string
+	TLSMinVersion      string
+	TLSCiphers         []string
+	BaselineFile       string
+	DeviationPercent   float64
+	NoBaselineState    string
+	InterruptState     string
+	WarnMin            float64
+	WarnMax            float64
+	WarnValue          float64
+	Critical           string
+	Warning            string
+	Condition          string
+	MetricRegex        bool
+	RulesFile          string
+	MinCount           int
+	MaxCount           int
+	Absent             bool
+	OnMissing          string
+	Query              string
+	RangeDuration      string
+	RangeStep          string
+	RangeFunction      string
+	Rate               bool
+	StateBackend       string
+	SensuAPIURL        string
+	SensuAPIKey        string
+	SensuNamespace     string
+	SensuEntity        string
+	SensuCheck         string
+	SampleInterval     int
+	SummaryQuantile    float64
+	BucketLe           float64
+	MetricNumerator    string
+	MetricDenominator  string
+	RatioOn            []string
+	CompareUrl         string
+	Compare            string
+	OutputMetrics      bool
+	OutputMetricFormat string
+	Collect            bool
+	Output             string
+	OutputTemplate     string
+	Humanize           bool
+	LogFormat          string
+	SortBy             string
+	Timeout            int
+	Retries            int
+	RetryDelay         string
+	ProxyUrl           string
+	Socks5             string
+	Headers            []string
+	BearerToken        string
+	BearerTokenFile    string
+	PasswordFile       string
+	OAuth2ClientID     string
+	OAuth2ClientSecret string
+	OAuth2TokenURL     string
+	OAuth2Scopes       []string
+	Sigv4Region        string
+	GoogleAuth         bool
+	GoogleCredentials  string
+	Netrc              bool
+	NetrcFile          string
+	HTTPConfigFile     string
+	Stdin              bool
+	Method             string
+	Body               string
+	Params             []string
+	TargetsFile        string
+	KubeService        string
+	KubePort           string
+	ConsulService      string
+	ConsulTags         []string
+	ConsulAddr         string
+	ConsulToken        string
+	MaxOutputLines     int
+	DnsSdName          string
+	TLSServerName      string
 }
 
 type Tag struct {
@@ -52,18 +196,21 @@ var (
 		},
 	}
 	options = []sensu.ConfigOption{
-		&sensu.PluginConfigOption[string]{
-			Path:     "url",
-			Argument: "url",
-			Default:  "http://localhost:9182/metrics",
-			Usage:    "URL to the Prometheus metrics",
-			Value:    &plugin.Url,
+		&sensu.SlicePluginConfigOption[string]{
+			Path:                "url",
+			Argument:            "url",
+			Default:             []string{},
+			Usage:               "URL to the Prometheus metrics, unix:///path/to/socket/metrics to scrape over a Unix socket or file:///path/to/file to read a file, can be used multiple times, " + defaultURL + " when no other target is given",
+			UseCobraStringArray: true,
+			Value:               &plugin.Urls,
 		},
-		&sensu.PluginConfigOption[string]{
-			Path:     "metric",
-			Argument: "metric",
-			Usage:    "Metric to check",
-			Value:    &plugin.Metric,
+		&sensu.SlicePluginConfigOption[string]{
+			Path:                "metric",
+			Argument:            "metric",
+			Usage:               "Metric to check, can be used multiple times",
+			Default:             []string{},
+			UseCobraStringArray: true,
+			Value:               &plugin.Metrics,
 		},
 		&sensu.PluginConfigOption[float64]{
 			Path:     "min",
@@ -89,7 +236,7 @@ var (
 		&sensu.SlicePluginConfigOption[string]{
 			Path:     "label",
 			Argument: "label",
-			Usage:    "limit check to metric with sepcific label, can be used muliple times",
+			Usage:    "limit check to metric with specific label (name:value, name: for an absent label, or name:@file listing accepted values), can be used multiple times",
 			Default:  []string{},
 			Value:    &plugin.Labels,
 		},
@@ -102,7 +249,9 @@ var (
 		&sensu.PluginConfigOption[string]{
 			Path:     "password",
 			Argument: "password",
+			Env:      "PROMETHEUS_PASSWORD",
 			Usage:    "Password for basic auth",
+			Secret:   true,
 			Value:    &plugin.Password,
 		},
 		&sensu.PluginConfigOption[string]{
@@ -129,140 +278,2179 @@ var (
 			Usage:    "insecureskipverify option if using self signed certs.",
 			Value:    &plugin.insecureSkipVerify,
 		},
-	}
-)
-
-func main() {
-	check := sensu.NewCheck(&plugin.PluginConfig, options, checkArgs, executeCheck, false)
-	check.Execute()
-}
-
-func checkArgs(event *corev2.Event) (int, error) {
-	if plugin.Metric == "" {
-		return sensu.CheckStateUnknown, errors.New("--metric is required")
-	}
-	if plugin.Value == math.Pi && plugin.Max == math.Pi && plugin.Min == math.Pi {
-		return sensu.CheckStateUnknown, errors.New("don't do that")
-	}
-
-	return sensu.CheckStateOK, nil
-}
-func QueryExporter(exporterURL string, user string, password string, insecureSkipVerify bool, cert string, key string, cacert string) (model.Vector, error) {
-
-	tlsconfig := &tls.Config{}
-
-	if insecureSkipVerify {
-		tlsconfig = &tls.Config{InsecureSkipVerify: true}
-	}
-
-	if len(cert) > 0 || len(key) > 0 || len(cacert) > 0 {
-		certpair, err := tls.LoadX509KeyPair(cert, key)
-		if err != nil {
-			fmt.Printf("could not load certificate(%s) or key(%s): %v", cert, key, err)
-			return nil, err
-		}
-
-		cacertfile, err := os.ReadFile(cacert)
-		if err != nil {
-			fmt.Printf("could not load CA(%s): %v", cacert, err)
-			return nil, err
-		}
-		rootca := x509.NewCertPool()
-		rootca.AppendCertsFromPEM(cacertfile)
-		tlsconfig = &tls.Config{
-			Certificates: []tls.Certificate{certpair},
-			RootCAs:      rootca,
-		}
-	}
-
-	tr := &http.Transport{
-		TLSClientConfig: tlsconfig,
-	}
-	client := &http.Client{Transport: tr}
-	req, err := http.NewRequest("GET", exporterURL, nil)
-	if err != nil {
-		return nil, err
-	}
-	if user != "" && password != "" {
-		req.SetBasicAuth(user, password)
-	}
-
-	expResponse, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer expResponse.Body.Close()
-
-	if expResponse.StatusCode != http.StatusOK {
-		return nil, errors.New("exporter returned non OK HTTP response status: " + expResponse.Status)
-	}
-
-	var parser expfmt.TextParser
-
-	metricFamilies, err := parser.TextToMetricFamilies(expResponse.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	samples := model.Vector{}
-
-	decodeOptions := &expfmt.DecodeOptions{
-		Timestamp: model.Time(time.Now().Unix()),
-	}
-
-	for _, family := range metricFamilies {
-		familySamples, _ := expfmt.ExtractSamples(decodeOptions, family)
-		samples = append(samples, familySamples...)
-	}
-
-	return samples, nil
-}
-func executeCheck(event *corev2.Event) (int, error) {
-
-	var samples model.Vector
-	var err error
-
-	samples, err = QueryExporter(plugin.Url, plugin.User, plugin.Password, plugin.insecureSkipVerify, plugin.Cert, plugin.Key, plugin.CaCert)
-	if err != nil {
-		fmt.Printf("Failed: %s\n", err)
-		return sensu.CheckStateUnknown, nil
-	}
-	exitLater := 0
-	for _, value := range samples {
-		if value.Metric["__name__"] == model.LabelValue(plugin.Metric) {
-			matchLabel := 0
-			if len(plugin.Labels) > 0 {
-				for _, label := range plugin.Labels {
-					labelSplit := strings.SplitN(label, ":", 2)
-					labelName := strings.TrimSpace(labelSplit[0])
-					labelValue := strings.TrimSpace(labelSplit[1])
-					if value.Metric[model.LabelName(labelName)] == model.LabelValue(labelValue) {
-						matchLabel += 1
-					}
-				}
-			}
-			if len(plugin.Labels) != matchLabel {
-				fmt.Printf("Metric %s does not match all specified labels\n", value.Metric.String())
-				exitLater += 1
-			}
-			if plugin.Value != math.Pi && (value.Value != model.SampleValue(plugin.Value)) {
-				fmt.Printf("Metric %s is at %f. Check require value %f\n", value.Metric.String(), value.Value, plugin.Value)
-				exitLater += 1
-			}
-			if plugin.Min != math.Pi && (value.Value < model.SampleValue(plugin.Min)) {
-				fmt.Printf("Metric %s is at %f. Check require minimum %f\n", value.Metric.String(), value.Value, plugin.Min)
-				exitLater += 1
-			}
-			if plugin.Max != math.Pi && (value.Value > model.SampleValue(plugin.Max)) {
-				fmt.Printf("Metric %s is at %f. Check require maximum %f\n", value.Metric.String(), value.Value, plugin.Max)
-				exitLater += 1
-			}
-		}
-	}
-	if exitLater > 0 {
-		return sensu.CheckStateCritical, nil
-	} else {
-		fmt.Printf("Metric %s is within reqired value\n", plugin.Metric)
-		return sensu.CheckStateOK, nil
-	}
+		&sensu.PluginConfigOption[string]{
+			Path:     "aggregate",
+			Argument: "aggregate",
+			Usage:    "Aggregate matching series before checking thresholds (sum, avg, min, max, count, stddev)",
+			Allow:    aggregations,
+			Value:    &plugin.Aggregate,
+		},
+		&sensu.SlicePluginConfigOption[string]{
+			Path:     "group-by",
+			Argument: "group-by",
+			Usage:    "Label to group series by when aggregating, can be used multiple times",
+			Default:  []string{},
+			Value:    &plugin.GroupBy,
+		},
+		&sensu.PluginConfigOption[int]{
+			Path:     "min-healthy",
+			Argument: "min-healthy",
+			Usage:    "Pass if at least this many series are within thresholds, regardless of how many fail",
+			Value:    &plugin.MinHealthy,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "empty-state",
+			Argument: "empty-state",
+			Default:  "unknown",
+			Usage:    "State to return when the exporter responds without any metrics (ok, warning, critical, unknown)",
+			Allow:    stateNames,
+			Value:    &plugin.EmptyState,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "srv",
+			Argument: "srv",
+			Usage:    "Discover the exporter from a DNS SRV record, ignored when --url is given",
+			Value:    &plugin.Srv,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "dns-sd-name",
+			Argument: "dns-sd-name",
+			Usage:    "Same as --srv with --srv-all, scraping every target of the DNS SRV record, taking precedence over --srv when given",
+			Value:    &plugin.DnsSdName,
+		},
+		&sensu.PluginConfigOption[bool]{
+			Path:     "srv-all",
+			Argument: "srv-all",
+			Usage:    "Scrape every target of the --srv record instead of the preferred one",
+			Value:    &plugin.SrvAll,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "scheme",
+			Argument: "scheme",
+			Default:  "http",
+			Usage:    "Scheme used to build URLs of discovered targets and --hosts",
+			Allow:    []string{"http", "https"},
+			Value:    &plugin.Scheme,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "path",
+			Argument: "path",
+			Default:  "/metrics",
+			Usage:    "Path used to build URLs of discovered targets and --hosts",
+			Value:    &plugin.Path,
+		},
+		&sensu.PluginConfigOption[int]{
+			Path:     "max-failures",
+			Argument: "max-failures",
+			Default:  20,
+			Usage:    "Maximum number of failing series to print, 0 prints all of them",
+			Value:    &plugin.MaxFailures,
+		},
+		&sensu.PluginConfigOption[int]{
+			Path:     "max-output-lines",
+			Argument: "max-output-lines",
+			Usage:    "Same as --max-failures, taking precedence over it when given",
+			Value:    &plugin.MaxOutputLines,
+		},
+		&sensu.PluginConfigOption[bool]{
+			Path:     "check-up",
+			Argument: "check-up",
+			Usage:    "Check the up metric and fail for every target that is not up",
+			Value:    &plugin.CheckUp,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "state-file",
+			Argument: "state-file",
+			Usage:    "File to persist series values between runs",
+			Value:    &plugin.StateFile,
+		},
+		&sensu.PluginConfigOption[float64]{
+			Path:     "delta-min",
+			Argument: "delta-min",
+			Default:  math.Pi,
+			Usage:    "Minimum change of metric since the previous run, requires --state-file",
+			Value:    &plugin.DeltaMin,
+		},
+		&sensu.PluginConfigOption[float64]{
+			Path:     "delta-max",
+			Argument: "delta-max",
+			Default:  math.Pi,
+			Usage:    "Maximum change of metric since the previous run, requires --state-file",
+			Value:    &plugin.DeltaMax,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "urls-file",
+			Argument: "urls-file",
+			Usage:    "File listing the exporter URLs or hosts to scrape, one per line, ignored when --url is given",
+			Value:    &plugin.UrlsFile,
+		},
+		&sensu.PluginConfigOption[int]{
+			Path:     "concurrency",
+			Argument: "concurrency",
+			Default:  10,
+			Usage:    "Number of exporters scraped at the same time",
+			Value:    &plugin.Concurrency,
+		},
+		&sensu.PluginConfigOption[float64]{
+			Path:     "scale",
+			Argument: "scale",
+			Default:  1,
+			Usage:    "Multiply metric values by this factor before checking thresholds",
+			Value:    &plugin.Scale,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "unit",
+			Argument: "unit",
+			Usage:    "Unit the thresholds are expressed in, metric values are converted to it before checking (K, M, G, T, Ki, Mi, Gi, Ti)",
+			Allow:    unitNames,
+			Value:    &plugin.Unit,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "duplicate-state",
+			Argument: "duplicate-state",
+			Default:  "ok",
+			Usage:    "State to return when a checked series is exposed more than once in a scrape, the last value is used (ok, warning, critical, unknown)",
+			Allow:    stateNames,
+			Value:    &plugin.DuplicateState,
+		},
+		&sensu.PluginConfigOption[bool]{
+			Path:     "connect-test",
+			Argument: "connect-test",
+			Usage:    "Only check that the exporter can be scraped, without evaluating any thresholds",
+			Value:    &plugin.ConnectTest,
+		},
+		&sensu.PluginConfigOption[bool]{
+			Path:     "label-ci",
+			Argument: "label-ci",
+			Usage:    "Compare --label values case-insensitively",
+			Value:    &plugin.LabelCI,
+		},
+		&sensu.PluginConfigOption[int]{
+			Path:     "max-age",
+			Argument: "max-age",
+			Usage:    "Maximum age in seconds of the timestamp exposed with a series before it is considered stale, 0 disables the check",
+			Value:    &plugin.MaxAge,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "missing-state",
+			Argument: "missing-state",
+			Default:  "ok",
+			Usage:    "State to return when no series matches the metric and labels (ok, warning, critical, unknown)",
+			Allow:    stateNames,
+			Value:    &plugin.MissingState,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "stale-state",
+			Argument: "stale-state",
+			Default:  "critical",
+			Usage:    "State to return when a series is older than --max-age (ok, warning, critical, unknown)",
+			Allow:    stateNames,
+			Value:    &plugin.StaleState,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "nan-state",
+			Argument: "nan-state",
+			Default:  "ok",
+			Usage:    "State to return when a series is NaN, NaN series are not checked against thresholds (ok, warning, critical, unknown)",
+			Allow:    stateNames,
+			Value:    &plugin.NaNState,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "expect-type",
+			Argument: "expect-type",
+			Usage:    "Return unknown if the metric is not declared with this type (counter, gauge, summary, untyped, histogram, gauge_histogram)",
+			Allow:    []string{"counter", "gauge", "summary", "untyped", "histogram", "gauge_histogram"},
+			Value:    &plugin.ExpectType,
+		},
+		&sensu.PluginConfigOption[bool]{
+			Path:     "age-of",
+			Argument: "age-of",
+			Usage:    "Treat the metric value as a unix timestamp and check thresholds against its age in seconds",
+			Value:    &plugin.AgeOf,
+		},
+		&sensu.PluginConfigOption[float64]{
+			Path:     "quantile",
+			Argument: "quantile",
+			Default:  math.Pi,
+			Usage:    "Check the quantile (0 to 1) of a summary or histogram metric",
+			Value:    &plugin.Quantile,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "label-match",
+			Argument: "label-match",
+			Default:  "all",
+			Usage:    "Whether series must match all or any of the --label specs (all, any)",
+			Allow:    []string{"all", "any"},
+			Value:    &plugin.LabelMatch,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "log-level",
+			Argument: "log-level",
+			Default:  "warn",
+			Usage:    "Level of the diagnostic logs written to stderr (debug, info, warn, error)",
+			Allow:    promslog.LevelFlagOptions,
+			Value:    &plugin.LogLevel,
+		},
+		&sensu.PluginConfigOption[int]{
+			Path:     "connect-timeout",
+			Argument: "connect-timeout",
+			Usage:    "Timeout in seconds for establishing the connection to the exporter, 0 waits for the system timeout",
+			Value:    &plugin.ConnectTimeout,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "expr",
+			Argument: "expr",
+			Usage:    "Check an arithmetic expression over metrics instead of --metric, e.g. \"http_errors_total / http_requests_total\" (+, -, *, / and parentheses)",
+			Value:    &plugin.Expr,
+		},
+		&sensu.SlicePluginConfigOption[string]{
+			Path:     "output-labels",
+			Argument: "output-labels",
+			Usage:    "Labels to show in output lines, all labels are shown by default",
+			Default:  []string{},
+			Value:    &plugin.OutputLabels,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "credentials-file",
+			Argument: "credentials-file",
+			Usage:    "File containing user:password for basic auth, instead of --user and --password",
+			Value:    &plugin.CredentialsFile,
+		},
+		&sensu.PluginConfigOption[bool]{
+			Path:     "require-change",
+			Argument: "require-change",
+			Usage:    "Fail when a series has the same value as on the previous run, requires --state-file",
+			Value:    &plugin.RequireChange,
+		},
+		&sensu.PluginConfigOption[bool]{
+			Path:     "worst-only",
+			Argument: "worst-only",
+			Usage:    "Only print the failing series furthest from its threshold",
+			Value:    &plugin.WorstOnly,
+		},
+		&sensu.SlicePluginConfigOption[string]{
+			Path:     "hosts",
+			Argument: "hosts",
+			Usage:    "Hosts to scrape, URLs are built from --scheme, --port and --path, ignored when --url is given",
+			Default:  []string{},
+			Value:    &plugin.Hosts,
+		},
+		&sensu.PluginConfigOption[int]{
+			Path:     "port",
+			Argument: "port",
+			Usage:    "Port used to build URLs of --hosts and bare hosts in --urls-file or --targets-file, 0 uses the default port of --scheme",
+			Value:    &plugin.Port,
+		},
+		&sensu.PluginConfigOption[float64]{
+			Path:     "tolerance",
+			Argument: "tolerance",
+			Usage:    "Maximum difference between metric and --value for it to be considered equal",
+			Value:    &plugin.Tolerance,
+		},
+		&sensu.SlicePluginConfigOption[string]{
+			Path:     "require-labels",
+			Argument: "require-labels",
+			Usage:    "Label values that must each appear in at least one series (name=value1,value2), can be used multiple times",
+			Default:  []string{},
+			Value:    &plugin.RequireLabels,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "fallback-url",
+			Argument: "fallback-url",
+			Usage:    "URL to the Prometheus metrics scraped when --url fails",
+			Value:    &plugin.FallbackUrl,
+		},
+		&sensu.PluginConfigOption[bool]{
+			Path:     "perfdata",
+			Argument: "perfdata",
+			Usage:    "Append Nagios performance data with the value of every series to the output",
+			Value:    &plugin.Perfdata,
+		},
+		&sensu.SlicePluginConfigOption[string]{
+			Path:     "exclude",
+			Argument: "exclude",
+			Usage:    "Metric name or regex to drop from evaluation, can be used multiple times",
+			Default:  []string{},
+			Value:    &plugin.Excludes,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "user-agent",
+			Argument: "user-agent",
+			Usage:    "User-Agent header sent to exporters, defaults to sensu-prometheus-metrics-checks/<version>",
+			Value:    &plugin.UserAgent,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "active-window",
+			Argument: "active-window",
+			Usage:    "Only check thresholds within this weekly window, e.g. 'Mon-Fri 09:00-17:00'",
+			Value:    &plugin.ActiveWindow,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "timezone",
+			Argument: "timezone",
+			Default:  "Local",
+			Usage:    "Timezone the --active-window is evaluated in",
+			Value:    &plugin.Timezone,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "inactive-state",
+			Argument: "inactive-state",
+			Default:  "ok",
+			Usage:    "State to return outside of the --active-window (ok, warning, critical, unknown)",
+			Allow:    stateNames,
+			Value:    &plugin.InactiveState,
+		},
+		&sensu.PluginConfigOption[bool]{
+			Path:     "fail-fast",
+			Argument: "fail-fast",
+			Usage:    "Stop evaluating series at the first critical one, series counts are then incomplete",
+			Value:    &plugin.FailFast,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "metric-prefix",
+			Argument: "metric-prefix",
+			Usage:    "Check every metric whose name starts with this prefix instead of --metric",
+			Value:    &plugin.MetricPrefix,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "metric-suffix",
+			Argument: "metric-suffix",
+			Usage:    "Check every metric whose name ends with this suffix instead of --metric",
+			Value:    &plugin.MetricSuffix,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "cardinality-by",
+			Argument: "cardinality-by",
+			Usage:    "Print the number of series per value of this label instead of checking thresholds",
+			Value:    &plugin.CardinalityBy,
+		},
+		&sensu.PluginConfigOption[int]{
+			Path:     "count-max",
+			Argument: "count-max",
+			Usage:    "Maximum number of series per --cardinality-by group, 0 allows any number",
+			Value:    &plugin.CountMax,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "servername",
+			Argument: "servername",
+			Usage:    "Server name used for SNI and to verify the exporter certificate instead of the URL host",
+			Value:    &plugin.ServerName,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "tls-server-name",
+			Argument: "tls-server-name",
+			Usage:    "Same as --servername, taking precedence over it when given",
+			Value:    &plugin.TLSServerName,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "tls-min-version",
+			Argument: "tls-min-version",
+			Usage:    "Minimum TLS version accepted from exporters (1.0, 1.1, 1.2, 1.3)",
+			Value:    &plugin.TLSMinVersion,
+		},
+		&sensu.SlicePluginConfigOption[string]{
+			Path:     "tls-ciphers",
+			Argument: "tls-ciphers",
+			Usage:    "TLS cipher suites offered to exporters for TLS 1.2 and older, can be used multiple times",
+			Default:  []string{},
+			Value:    &plugin.TLSCiphers,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "baseline-file",
+			Argument: "baseline-file",
+			Usage:    "File in the Prometheus text format with the expected value of every series",
+			Value:    &plugin.BaselineFile,
+		},
+		&sensu.PluginConfigOption[float64]{
+			Path:     "deviation-percent",
+			Argument: "deviation-percent",
+			Default:  10,
+			Usage:    "Maximum deviation of metric from its --baseline-file value, in percent",
+			Value:    &plugin.DeviationPercent,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "no-baseline-state",
+			Argument: "no-baseline-state",
+			Default:  "warning",
+			Usage:    "State to return for series missing from the --baseline-file (ok, warning, critical, unknown)",
+			Allow:    stateNames,
+			Value:    &plugin.NoBaselineState,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "interrupt-state",
+			Argument: "interrupt-state",
+			Default:  "unknown",
+			Usage:    "State to return when interrupted by SIGTERM or SIGINT, raised by failures found until then (ok, warning, critical, unknown)",
+			Allow:    stateNames,
+			Value:    &plugin.InterruptState,
+		},
+		&sensu.PluginConfigOption[float64]{
+			Path:     "warn-min",
+			Argument: "warn-min",
+			Default:  math.Pi,
+			Usage:    "Minimum value of metric before returning warning",
+			Value:    &plugin.WarnMin,
+		},
+		&sensu.PluginConfigOption[float64]{
+			Path:     "warn-max",
+			Argument: "warn-max",
+			Default:  math.Pi,
+			Usage:    "Maximum value of metric before returning warning",
+			Value:    &plugin.WarnMax,
+		},
+		&sensu.PluginConfigOption[float64]{
+			Path:     "warn-value",
+			Argument: "warn-value",
+			Default:  math.Pi,
+			Usage:    "Value metric has to be at to not return warning",
+			Value:    &plugin.WarnValue,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "critical",
+			Argument: "critical",
+			Usage:    "Nagios range of metric values that return critical, e.g. 10, 10:, ~:10, 10:20 or @10:20",
+			Value:    &plugin.Critical,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "warning",
+			Argument: "warning",
+			Usage:    "Nagios range of metric values that return warning, e.g. 10, 10:, ~:10, 10:20 or @10:20",
+			Value:    &plugin.Warning,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "condition",
+			Argument: "condition",
+			Usage:    "Condition every series has to meet, e.g. 'value > 5 && value < 100'",
+			Value:    &plugin.Condition,
+		},
+		&sensu.PluginConfigOption[bool]{
+			Path:     "metric-regex",
+			Argument: "metric-regex",
+			Usage:    "Treat --metric as a regex that has to match the whole metric name",
+			Value:    &plugin.MetricRegex,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "rules-file",
+			Argument: "rules-file",
+			Usage:    "YAML or JSON file of rules checking several metrics from one scrape, instead of --metric",
+			Value:    &plugin.RulesFile,
+		},
+		&sensu.PluginConfigOption[int]{
+			Path:     "min-count",
+			Argument: "min-count",
+			Usage:    "Minimum number of series matching the metric and labels, 0 disables the check",
+			Value:    &plugin.MinCount,
+		},
+		&sensu.PluginConfigOption[int]{
+			Path:     "max-count",
+			Argument: "max-count",
+			Usage:    "Maximum number of series matching the metric and labels, 0 disables the check",
+			Value:    &plugin.MaxCount,
+		},
+		&sensu.PluginConfigOption[bool]{
+			Path:     "absent",
+			Argument: "absent",
+			Usage:    "Only check that the metric is present, returning critical when no series matches",
+			Value:    &plugin.Absent,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "on-missing",
+			Argument: "on-missing",
+			Usage:    "Same as --missing-state, taking precedence over it when given",
+			Allow:    stateNames,
+			Value:    &plugin.OnMissing,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "query",
+			Argument: "query",
+			Usage:    "PromQL query to evaluate on the Prometheus server at --url instead of scraping --metric",
+			Value:    &plugin.Query,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "range-duration",
+			Argument: "range-duration",
+			Usage:    "Evaluate --query as a range query over this duration, e.g. 15m",
+			Value:    &plugin.RangeDuration,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "range-step",
+			Argument: "range-step",
+			Default:  "1m",
+			Usage:    "Resolution of the --range-duration range query",
+			Value:    &plugin.RangeStep,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "range-function",
+			Argument: "range-function",
+			Default:  "last",
+			Usage:    "Value of each series of the range query thresholds are checked against (last, avg, min, max)",
+			Allow:    rangeFunctions,
+			Value:    &plugin.RangeFunction,
+		},
+		&sensu.PluginConfigOption[bool]{
+			Path:     "rate",
+			Argument: "rate",
+			Usage:    "Check the per-second rate of metric since the previous run instead of its value, requires --state-file",
+			Value:    &plugin.Rate,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "state-backend",
+			Argument: "state-backend",
+			Default:  "file",
+			Usage:    "Where to persist state between runs, in --state-file or in the Sensu entity of the check's event",
+			Allow:    []string{"event"},
+			Value:    &plugin.StateBackend,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "sensu-api-url",
+			Argument: "sensu-api-url",
+			Default:  "http://localhost:8080",
+			Usage:    "Sensu backend API URL for --state-backend event and templates",
+			Value:    &plugin.SensuAPIURL,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "sensu-api-key",
+			Argument: "sensu-api-key",
+			Env:      "SENSU_API_KEY",
+			Usage:    "Sensu API key for --state-backend event and templates",
+			Secret:   true,
+			Value:    &plugin.SensuAPIKey,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "sensu-namespace",
+			Argument: "sensu-namespace",
+			Default:  "default",
+			Usage:    "Sensu namespace of the entity for --state-backend event and templates",
+			Value:    &plugin.SensuNamespace,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "sensu-entity",
+			Argument: "sensu-entity",
+			Usage:    "Sensu entity the check runs on for --state-backend event and templates, e.g. {{ .name }}",
+			Value:    &plugin.SensuEntity,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "sensu-check",
+			Argument: "sensu-check",
+			Usage:    "Name of the Sensu check for --state-backend event",
+			Value:    &plugin.SensuCheck,
+		},
+		&sensu.PluginConfigOption[int]{
+			Path:     "sample-interval",
+			Argument: "sample-interval",
+			Usage:    "Scrape twice this many seconds apart and check the per-second rate of metric between both scrapes",
+			Value:    &plugin.SampleInterval,
+		},
+		&sensu.PluginConfigOption[float64]{
+			Path:     "summary-quantile",
+			Argument: "summary-quantile",
+			Default:  math.Pi,
+			Usage:    "Check the series of metric with this quantile label, without requiring the metric to be declared as a summary",
+			Value:    &plugin.SummaryQuantile,
+		},
+		&sensu.PluginConfigOption[float64]{
+			Path:     "bucket-le",
+			Argument: "bucket-le",
+			Default:  math.Pi,
+			Usage:    "Check the fraction (0 to 1) of observations of a histogram metric in the bucket with this upper bound",
+			Value:    &plugin.BucketLe,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "metric-numerator",
+			Argument: "metric-numerator",
+			Usage:    "Check the ratio of this metric to --metric-denominator instead of --metric",
+			Value:    &plugin.MetricNumerator,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "metric-denominator",
+			Argument: "metric-denominator",
+			Usage:    "Metric --metric-numerator is divided by",
+			Value:    &plugin.MetricDenominator,
+		},
+		&sensu.SlicePluginConfigOption[string]{
+			Path:     "ratio-on",
+			Argument: "ratio-on",
+			Default:  []string{},
+			Usage:    "Labels series of --metric-numerator and --metric-denominator are matched on, all labels by default",
+			Value:    &plugin.RatioOn,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "compare-url",
+			Argument: "compare-url",
+			Usage:    "Also scrape metric from this URL and check how the series of --url compare to it",
+			Value:    &plugin.CompareUrl,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "compare",
+			Argument: "compare",
+			Default:  "difference",
+			Usage:    "How series are compared with --compare-url (difference, ratio)",
+			Allow:    []string{"ratio"},
+			Value:    &plugin.Compare,
+		},
+		&sensu.PluginConfigOption[bool]{
+			Path:     "output-metrics",
+			Argument: "output-metrics",
+			Usage:    "Print the value of every series as a metric point after the check result, for Sensu output metric extraction",
+			Value:    &plugin.OutputMetrics,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "output-metric-format",
+			Argument: "output-metric-format",
+			Default:  "prometheus_text",
+			Usage:    "Format of the --output-metrics and --collect metric points (prometheus_text, graphite_plaintext, influxdb_line, opentsdb_line)",
+			Allow:    metricFormats,
+			Value:    &plugin.OutputMetricFormat,
+		},
+		&sensu.PluginConfigOption[bool]{
+			Path:     "collect",
+			Argument: "collect",
+			Usage:    "Print every selected series as a metric point without checking thresholds, selecting all metrics without --metric",
+			Value:    &plugin.Collect,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "output",
+			Argument: "output",
+			Default:  "text",
+			Usage:    "Print the check result as text or as a single JSON document (text, json)",
+			Allow:    []string{"json"},
+			Value:    &plugin.Output,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "output-template",
+			Argument: "output-template",
+			Usage:    "Go template of the failure lines of series, e.g. \"{{.Labels.instance}} {{.Value}} > {{.Max}}\"",
+			Value:    &plugin.OutputTemplate,
+		},
+		&sensu.PluginConfigOption[bool]{
+			Path:     "humanize",
+			Argument: "humanize",
+			Usage:    "Render values and thresholds in output with units such as GiB, ms or %, picked from the metric name suffix or --unit",
+			Value:    &plugin.Humanize,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "log-format",
+			Argument: "log-format",
+			Default:  "text",
+			Usage:    "Format of the diagnostic logs written to stderr (text, json)",
+			Allow:    []string{"json"},
+			Value:    &plugin.LogFormat,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "sort-by",
+			Argument: "sort-by",
+			Usage:    "Order of the failing series printed, worst first by value or by name (value, name)",
+			Allow:    []string{"value", "name"},
+			Value:    &plugin.SortBy,
+		},
+		&sensu.PluginConfigOption[int]{
+			Path:     "timeout",
+			Argument: "timeout",
+			Usage:    "Timeout in seconds for each scrape, from connecting to reading the last metric, 0 waits indefinitely",
+			Value:    &plugin.Timeout,
+		},
+		&sensu.PluginConfigOption[int]{
+			Path:     "retries",
+			Argument: "retries",
+			Usage:    "Number of times a scrape failing with a refused or reset connection or a 5xx response is retried",
+			Value:    &plugin.Retries,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "retry-delay",
+			Argument: "retry-delay",
+			Default:  "1s",
+			Usage:    "Delay before the first retry, doubled before each following retry",
+			Value:    &plugin.RetryDelay,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "proxy-url",
+			Argument: "proxy-url",
+			Usage:    "URL of the HTTP proxy to scrape through, instead of the proxy set by HTTP_PROXY, HTTPS_PROXY and NO_PROXY",
+			Value:    &plugin.ProxyUrl,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "socks5",
+			Argument: "socks5",
+			Usage:    "SOCKS5 proxy to scrape through, as [user:password@]host:port",
+			Value:    &plugin.Socks5,
+		},
+		&sensu.SlicePluginConfigOption[string]{
+			Path:                "header",
+			Argument:            "header",
+			Usage:               "Header to send with every scrape (Name: value), can be used multiple times",
+			Default:             []string{},
+			UseCobraStringArray: true,
+			Value:               &plugin.Headers,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "bearer-token",
+			Argument: "bearer-token",
+			Env:      "PROMETHEUS_BEARER_TOKEN",
+			Usage:    "Token sent as Authorization: Bearer with every scrape, instead of basic auth",
+			Secret:   true,
+			Value:    &plugin.BearerToken,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "bearer-token-file",
+			Argument: "bearer-token-file",
+			Usage:    "File containing the bearer token, read again on every scrape, instead of --bearer-token",
+			Value:    &plugin.BearerTokenFile,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "password-file",
+			Argument: "password-file",
+			Usage:    "File containing the password for basic auth, read again on every scrape, instead of --password",
+			Value:    &plugin.PasswordFile,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "oauth2-client-id",
+			Argument: "oauth2-client-id",
+			Usage:    "OAuth2 client ID to fetch a token for the scrapes with the client credentials flow",
+			Value:    &plugin.OAuth2ClientID,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "oauth2-client-secret",
+			Argument: "oauth2-client-secret",
+			Env:      "PROMETHEUS_OAUTH2_CLIENT_SECRET",
+			Usage:    "OAuth2 client secret, for --oauth2-client-id",
+			Secret:   true,
+			Value:    &plugin.OAuth2ClientSecret,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "oauth2-token-url",
+			Argument: "oauth2-token-url",
+			Usage:    "OAuth2 token endpoint, for --oauth2-client-id",
+			Value:    &plugin.OAuth2TokenURL,
+		},
+		&sensu.SlicePluginConfigOption[string]{
+			Path:     "oauth2-scope",
+			Argument: "oauth2-scope",
+			Usage:    "OAuth2 scope to request, for --oauth2-client-id, can be used multiple times",
+			Default:  []string{},
+			Value:    &plugin.OAuth2Scopes,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "sigv4-region",
+			Argument: "sigv4-region",
+			Usage:    "AWS region to sign --query requests to Amazon Managed Service for Prometheus for, with the standard AWS credential chain",
+			Value:    &plugin.Sigv4Region,
+		},
+		&sensu.PluginConfigOption[bool]{
+			Path:     "google-auth",
+			Argument: "google-auth",
+			Usage:    "Authenticate --query requests to Google Cloud Managed Service for Prometheus with the Application Default Credentials",
+			Value:    &plugin.GoogleAuth,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "google-credentials-file",
+			Argument: "google-credentials-file",
+			Usage:    "Google credentials file, such as a service account key, for --google-auth, instead of the Application Default Credentials",
+			Value:    &plugin.GoogleCredentials,
+		},
+		&sensu.PluginConfigOption[bool]{
+			Path:     "netrc",
+			Argument: "netrc",
+			Usage:    "Look basic auth credentials up by target host in ~/.netrc",
+			Value:    &plugin.Netrc,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "netrc-file",
+			Argument: "netrc-file",
+			Usage:    "Look basic auth credentials up by target host in this netrc file, instead of ~/.netrc",
+			Value:    &plugin.NetrcFile,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "http-config-file",
+			Argument: "http-config-file",
+			Usage:    "Prometheus HTTP client configuration file to scrape with, instead of the TLS, authentication and proxy options",
+			Value:    &plugin.HTTPConfigFile,
+		},
+		&sensu.PluginConfigOption[bool]{
+			Path:     "stdin",
+			Argument: "stdin",
+			Usage:    "Read metrics in the text format from stdin instead of scraping --url",
+			Value:    &plugin.Stdin,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "method",
+			Argument: "method",
+			Default:  "GET",
+			Usage:    "HTTP method of the scrape requests",
+			Allow:    []string{"GET", "POST"},
+			Value:    &plugin.Method,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "body",
+			Argument: "body",
+			Usage:    "Body of the scrape requests, form data or JSON, requires --method POST",
+			Value:    &plugin.Body,
+		},
+		&sensu.SlicePluginConfigOption[string]{
+			Path:                "param",
+			Argument:            "param",
+			Usage:               "Query parameter to add to the scrape URL (name=value), e.g. collect[]=cpu to only ask node_exporter for its cpu collector, can be used multiple times",
+			Default:             []string{},
+			UseCobraStringArray: true,
+			Value:               &plugin.Params,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "targets-file",
+			Argument: "targets-file",
+			Usage:    "Prometheus file_sd file (JSON or YAML) listing the targets to scrape and their labels, ignored when --url is given",
+			Value:    &plugin.TargetsFile,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "kube-service",
+			Argument: "kube-service",
+			Usage:    "Scrape the ready endpoints of this Kubernetes service (namespace/name, or name in the namespace of the check's pod) with in-cluster credentials, ignored when --url is given",
+			Value:    &plugin.KubeService,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "kube-port",
+			Argument: "kube-port",
+			Usage:    "Name or number of the port --kube-service endpoints are scraped on, by default the only port of the service or the one named metrics",
+			Value:    &plugin.KubePort,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "consul-service",
+			Argument: "consul-service",
+			Usage:    "Scrape the instances of this service of the Consul catalog, ignored when --url is given",
+			Value:    &plugin.ConsulService,
+		},
+		&sensu.SlicePluginConfigOption[string]{
+			Path:     "consul-tag",
+			Argument: "consul-tag",
+			Usage:    "Only scrape the --consul-service instances with this tag, can be used multiple times",
+			Default:  []string{},
+			Value:    &plugin.ConsulTags,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "consul-addr",
+			Argument: "consul-addr",
+			Env:      "CONSUL_HTTP_ADDR",
+			Default:  "http://127.0.0.1:8500",
+			Usage:    "Consul API address for --consul-service",
+			Value:    &plugin.ConsulAddr,
+		},
+		&sensu.PluginConfigOption[string]{
+			Path:     "consul-token",
+			Argument: "consul-token",
+			Env:      "CONSUL_HTTP_TOKEN",
+			Usage:    "Consul ACL token for --consul-service",
+			Secret:   true,
+			Value:    &plugin.ConsulToken,
+		},
+	}
+)
+
+func main() {
+	check := sensu.NewCheck(&plugin.PluginConfig, options, checkArgs, executeCheck, false)
+	handleInterrupts()
+	check.Execute()
+}
+
+func checkArgs(event *corev2.Event) (int, error) {
+	var err error
+	logger, err = newLogger(plugin.LogLevel, plugin.LogFormat)
+	if err != nil {
+		return sensu.CheckStateUnknown, err
+	}
+	// Before the HTTP config file, which can't be used with it.
+	if plugin.TLSServerName != "" {
+		plugin.ServerName = plugin.TLSServerName
+	}
+	if plugin.HTTPConfigFile != "" {
+		if err := loadHTTPConfig(plugin.HTTPConfigFile); err != nil {
+			return sensu.CheckStateUnknown, err
+		}
+	}
+	if err := renderEntityTemplates(); err != nil {
+		return sensu.CheckStateUnknown, err
+	}
+	if plugin.OnMissing != "" {
+		plugin.MissingState = plugin.OnMissing
+	}
+	if plugin.MaxOutputLines != 0 {
+		plugin.MaxFailures = plugin.MaxOutputLines
+	}
+	if plugin.DnsSdName != "" {
+		plugin.Srv, plugin.SrvAll = plugin.DnsSdName, true
+	}
+	if plugin.CheckUp {
+		if len(plugin.Metrics) > 1 || (len(plugin.Metrics) == 1 && plugin.Metrics[0] != "up") {
+			return sensu.CheckStateUnknown, errors.New("--check-up can't be used with --metric")
+		}
+		plugin.Metrics = []string{"up"}
+	}
+	partial := plugin.MetricPrefix != "" || plugin.MetricSuffix != ""
+	if partial && (len(plugin.Metrics) > 0 || plugin.Expr != "") {
+		return sensu.CheckStateUnknown, errors.New("--metric-prefix and --metric-suffix can't be used with --metric or --expr")
+	}
+	if plugin.MetricRegex {
+		if len(plugin.Metrics) == 0 {
+			return sensu.CheckStateUnknown, errors.New("--metric-regex requires --metric")
+		}
+		for _, metric := range plugin.Metrics {
+			if _, err := metricPattern(metric); err != nil {
+				return sensu.CheckStateUnknown, err
+			}
+		}
+		if plugin.Quantile != math.Pi || plugin.SummaryQuantile != math.Pi || plugin.BucketLe != math.Pi {
+			return sensu.CheckStateUnknown, errors.New("--quantile, --summary-quantile and --bucket-le can't be used with --metric-regex")
+		}
+	}
+	if partial && plugin.Quantile != math.Pi {
+		return sensu.CheckStateUnknown, errors.New("--quantile requires --metric")
+	}
+	ratio := plugin.MetricNumerator != "" || plugin.MetricDenominator != ""
+	if ratio {
+		if plugin.MetricNumerator == "" || plugin.MetricDenominator == "" {
+			return sensu.CheckStateUnknown, errors.New("--metric-numerator and --metric-denominator must be used together")
+		}
+		if len(plugin.Metrics) > 0 || partial || plugin.Expr != "" || plugin.Query != "" || plugin.RulesFile != "" {
+			return sensu.CheckStateUnknown, errors.New("--metric-numerator can't be used with --metric, --metric-prefix, --metric-suffix, --expr, --query or --rules-file")
+		}
+	} else if len(plugin.RatioOn) > 0 {
+		return sensu.CheckStateUnknown, errors.New("--ratio-on requires --metric-numerator and --metric-denominator")
+	}
+	if plugin.Expr != "" {
+		if len(plugin.Metrics) > 0 {
+			return sensu.CheckStateUnknown, errors.New("--expr and --metric are mutually exclusive")
+		}
+		if _, err := parseExpr(plugin.Expr); err != nil {
+			return sensu.CheckStateUnknown, err
+		}
+	} else if plugin.Query != "" {
+		if len(plugin.Metrics) > 0 || partial || plugin.RulesFile != "" {
+			return sensu.CheckStateUnknown, errors.New("--query can't be used with --metric, --metric-prefix, --metric-suffix or --rules-file")
+		}
+		if plugin.RangeDuration != "" {
+			duration, err := model.ParseDuration(plugin.RangeDuration)
+			if err != nil || duration <= 0 {
+				return sensu.CheckStateUnknown, fmt.Errorf("invalid --range-duration %s", plugin.RangeDuration)
+			}
+			step, err := model.ParseDuration(plugin.RangeStep)
+			if err != nil || step <= 0 {
+				return sensu.CheckStateUnknown, fmt.Errorf("invalid --range-step %s", plugin.RangeStep)
+			}
+		}
+	} else if plugin.RulesFile != "" {
+		if len(plugin.Metrics) > 0 || partial {
+			return sensu.CheckStateUnknown, errors.New("--rules-file can't be used with --metric, --metric-prefix or --metric-suffix")
+		}
+		if _, err := loadRules(plugin.RulesFile); err != nil {
+			return sensu.CheckStateUnknown, err
+		}
+	} else if len(plugin.Metrics) == 0 && !partial && !ratio && !plugin.ConnectTest && !plugin.Collect && plugin.CardinalityBy == "" {
+		return sensu.CheckStateUnknown, errors.New("--metric is required")
+	}
+	if plugin.Collect && (plugin.Expr != "" || ratio || plugin.RulesFile != "" || plugin.CardinalityBy != "" || plugin.CompareUrl != "") {
+		return sensu.CheckStateUnknown, errors.New("--collect can't be used with --expr, --metric-numerator, --rules-file, --cardinality-by or --compare-url")
+	}
+	if plugin.OutputTemplate != "" {
+		if _, err := parseOutputTemplate(plugin.OutputTemplate); err != nil {
+			return sensu.CheckStateUnknown, err
+		}
+	}
+	if plugin.Output == "json" && (plugin.Perfdata || plugin.OutputMetrics || plugin.Collect) {
+		return sensu.CheckStateUnknown, errors.New("--output json can't be used with --perfdata, --output-metrics or --collect")
+	}
+	if plugin.CardinalityBy != "" {
+		if plugin.Expr != "" {
+			return sensu.CheckStateUnknown, errors.New("--cardinality-by can't be used with --expr")
+		}
+		if !model.LabelName(plugin.CardinalityBy).IsValidLegacy() {
+			return sensu.CheckStateUnknown, fmt.Errorf("--cardinality-by %s is not a valid label name", plugin.CardinalityBy)
+		}
+		if plugin.CountMax < 0 {
+			return sensu.CheckStateUnknown, errors.New("--count-max must not be negative")
+		}
+	} else if !plugin.CheckUp && !plugin.ConnectTest && !plugin.Collect && plugin.RulesFile == "" && !plugin.Absent && plugin.MinCount == 0 && plugin.MaxCount == 0 && plugin.Value == math.Pi && plugin.Max == math.Pi && plugin.Min == math.Pi && !warnEnabled() && plugin.Critical == "" && plugin.Warning == "" && plugin.Condition == "" && !deltaEnabled() && !plugin.RequireChange && plugin.BaselineFile == "" {
+		return sensu.CheckStateUnknown, errors.New("don't do that")
+	}
+	if _, err := parseTLSVersion(plugin.TLSMinVersion); err != nil {
+		return sensu.CheckStateUnknown, err
+	}
+	if _, err := parseCipherSuites(plugin.TLSCiphers); err != nil {
+		return sensu.CheckStateUnknown, err
+	}
+	if plugin.ActiveWindow != "" {
+		if _, err := parseActiveWindow(plugin.ActiveWindow); err != nil {
+			return sensu.CheckStateUnknown, err
+		}
+		if _, err := time.LoadLocation(plugin.Timezone); err != nil {
+			return sensu.CheckStateUnknown, fmt.Errorf("invalid --timezone %s: %v", plugin.Timezone, err)
+		}
+	}
+	if _, err := parseExcludes(plugin.Excludes); err != nil {
+		return sensu.CheckStateUnknown, err
+	}
+	if _, err := parseRequiredLabels(plugin.RequireLabels); err != nil {
+		return sensu.CheckStateUnknown, err
+	}
+	if err := validateLabelSpecs(plugin.Labels); err != nil {
+		return sensu.CheckStateUnknown, err
+	}
+	if len(plugin.GroupBy) > 0 && plugin.Aggregate == "" {
+		return sensu.CheckStateUnknown, errors.New("--group-by requires --aggregate")
+	}
+	if plugin.MinHealthy < 0 {
+		return sensu.CheckStateUnknown, errors.New("--min-healthy must not be negative")
+	}
+	if plugin.MaxFailures < 0 {
+		return sensu.CheckStateUnknown, errors.New("--max-failures must not be negative")
+	}
+	if plugin.Quantile != math.Pi && (plugin.Quantile < 0 || plugin.Quantile > 1) {
+		return sensu.CheckStateUnknown, errors.New("--quantile must be between 0 and 1")
+	}
+	if plugin.SummaryQuantile != math.Pi {
+		if plugin.SummaryQuantile < 0 || plugin.SummaryQuantile > 1 {
+			return sensu.CheckStateUnknown, errors.New("--summary-quantile must be between 0 and 1")
+		}
+		if plugin.Quantile != math.Pi {
+			return sensu.CheckStateUnknown, errors.New("--quantile and --summary-quantile are mutually exclusive")
+		}
+		if len(plugin.Metrics) == 0 {
+			return sensu.CheckStateUnknown, errors.New("--summary-quantile requires --metric")
+		}
+	}
+	if plugin.BucketLe != math.Pi {
+		if plugin.Quantile != math.Pi || plugin.SummaryQuantile != math.Pi {
+			return sensu.CheckStateUnknown, errors.New("--bucket-le can't be used with --quantile or --summary-quantile")
+		}
+		if len(plugin.Metrics) == 0 {
+			return sensu.CheckStateUnknown, errors.New("--bucket-le requires --metric")
+		}
+	}
+	if plugin.Timeout < 0 {
+		return sensu.CheckStateUnknown, errors.New("--timeout must not be negative")
+	}
+	if plugin.ProxyUrl != "" {
+		if _, err := proxyURL(); err != nil {
+			return sensu.CheckStateUnknown, err
+		}
+	}
+	if plugin.Socks5 != "" {
+		if plugin.ProxyUrl != "" {
+			return sensu.CheckStateUnknown, errors.New("--socks5 can't be used with --proxy-url")
+		}
+		if _, err := socks5Dialer(&net.Dialer{}); err != nil {
+			return sensu.CheckStateUnknown, err
+		}
+	}
+	if plugin.BearerToken != "" && plugin.BearerTokenFile != "" {
+		return sensu.CheckStateUnknown, errors.New("--bearer-token can't be used with --bearer-token-file")
+	}
+	if plugin.PasswordFile != "" && (plugin.Password != "" || plugin.CredentialsFile != "") {
+		return sensu.CheckStateUnknown, errors.New("--password-file can't be used with --password or --credentials-file")
+	}
+	if plugin.OAuth2ClientID != "" {
+		if plugin.OAuth2TokenURL == "" {
+			return sensu.CheckStateUnknown, errors.New("--oauth2-client-id requires --oauth2-token-url")
+		}
+		if plugin.User != "" || plugin.Password != "" || plugin.PasswordFile != "" || plugin.CredentialsFile != "" || plugin.BearerToken != "" || plugin.BearerTokenFile != "" {
+			return sensu.CheckStateUnknown, errors.New("--oauth2-client-id can't be used with basic auth or --bearer-token")
+		}
+	} else if plugin.OAuth2ClientSecret != "" || plugin.OAuth2TokenURL != "" || len(plugin.OAuth2Scopes) > 0 {
+		return sensu.CheckStateUnknown, errors.New("--oauth2-client-secret, --oauth2-token-url and --oauth2-scope require --oauth2-client-id")
+	}
+	if plugin.Sigv4Region != "" {
+		if plugin.Query == "" {
+			return sensu.CheckStateUnknown, errors.New("--sigv4-region requires --query")
+		}
+		if plugin.User != "" || plugin.Password != "" || plugin.PasswordFile != "" || plugin.CredentialsFile != "" || plugin.BearerToken != "" || plugin.BearerTokenFile != "" || plugin.OAuth2ClientID != "" {
+			return sensu.CheckStateUnknown, errors.New("--sigv4-region can't be used with basic auth, --bearer-token or --oauth2-client-id")
+		}
+	}
+	if plugin.GoogleAuth {
+		if plugin.Query == "" {
+			return sensu.CheckStateUnknown, errors.New("--google-auth requires --query")
+		}
+		if plugin.User != "" || plugin.Password != "" || plugin.PasswordFile != "" || plugin.CredentialsFile != "" || plugin.BearerToken != "" || plugin.BearerTokenFile != "" || plugin.OAuth2ClientID != "" || plugin.Sigv4Region != "" {
+			return sensu.CheckStateUnknown, errors.New("--google-auth can't be used with basic auth, --bearer-token, --oauth2-client-id or --sigv4-region")
+		}
+	} else if plugin.GoogleCredentials != "" {
+		return sensu.CheckStateUnknown, errors.New("--google-credentials-file requires --google-auth")
+	}
+	if (plugin.Netrc || plugin.NetrcFile != "") && (plugin.User != "" || plugin.CredentialsFile != "" || plugin.BearerToken != "" || plugin.BearerTokenFile != "" || plugin.OAuth2ClientID != "" || plugin.Sigv4Region != "" || plugin.GoogleAuth) {
+		return sensu.CheckStateUnknown, errors.New("--netrc and --netrc-file can't be used with --user, --credentials-file or token authentication")
+	}
+	if plugin.PasswordFile != "" && plugin.User == "" {
+		return sensu.CheckStateUnknown, errors.New("--password-file requires --user")
+	}
+	if (plugin.BearerToken != "" || plugin.BearerTokenFile != "") && (plugin.User != "" || plugin.Password != "" || plugin.PasswordFile != "" || plugin.CredentialsFile != "") {
+		return sensu.CheckStateUnknown, errors.New("--bearer-token and --bearer-token-file can't be used with --user, --password, --password-file or --credentials-file")
+	}
+	if _, err := parseHeaders(plugin.Headers); err != nil {
+		return sensu.CheckStateUnknown, err
+	}
+	// An explicit --url wins over every other way of finding the targets.
+	if len(plugin.Urls) > 0 && (len(plugin.Hosts) > 0 || plugin.Srv != "" || plugin.UrlsFile != "" || plugin.TargetsFile != "" || plugin.KubeService != "" || plugin.ConsulService != "") {
+		logger.Debug("ignoring --hosts, --srv, --urls-file, --targets-file, --kube-service and --consul-service, --url is given")
+		plugin.Hosts, plugin.Srv, plugin.UrlsFile, plugin.TargetsFile = nil, "", "", ""
+		plugin.KubeService, plugin.KubePort, plugin.ConsulService, plugin.ConsulTags = "", "", "", nil
+	}
+	if len(plugin.Urls) == 0 && len(plugin.Hosts) == 0 && plugin.Srv == "" && plugin.UrlsFile == "" && plugin.TargetsFile == "" && plugin.KubeService == "" && plugin.ConsulService == "" {
+		plugin.Urls = []string{defaultURL}
+	}
+	for _, target := range plugin.Urls {
+		if _, err := addParams(target, plugin.Params); err != nil {
+			return sensu.CheckStateUnknown, err
+		}
+	}
+	if plugin.Retries < 0 {
+		return sensu.CheckStateUnknown, errors.New("--retries must not be negative")
+	}
+	if plugin.Retries > 0 {
+		if delay, err := time.ParseDuration(plugin.RetryDelay); err != nil || delay < 0 {
+			return sensu.CheckStateUnknown, fmt.Errorf("invalid --retry-delay %s", plugin.RetryDelay)
+		}
+	}
+	if plugin.ConnectTimeout < 0 {
+		return sensu.CheckStateUnknown, errors.New("--connect-timeout must not be negative")
+	}
+	if plugin.MaxAge < 0 {
+		return sensu.CheckStateUnknown, errors.New("--max-age must not be negative")
+	}
+	if plugin.Concurrency < 1 {
+		return sensu.CheckStateUnknown, errors.New("--concurrency must be at least 1")
+	}
+	if plugin.Scale == 0 {
+		return sensu.CheckStateUnknown, errors.New("--scale must not be 0")
+	}
+	if plugin.Srv != "" && plugin.UrlsFile != "" {
+		return sensu.CheckStateUnknown, errors.New("--srv and --urls-file are mutually exclusive")
+	}
+	if plugin.TargetsFile != "" && (len(plugin.Hosts) > 0 || plugin.Srv != "" || plugin.UrlsFile != "" || plugin.FallbackUrl != "" || plugin.CompareUrl != "" || plugin.Stdin) {
+		return sensu.CheckStateUnknown, errors.New("--targets-file can't be used with --hosts, --srv, --urls-file, --fallback-url, --compare-url or --stdin")
+	}
+	if plugin.KubeService != "" && (len(plugin.Hosts) > 0 || plugin.Srv != "" || plugin.UrlsFile != "" || plugin.TargetsFile != "" || plugin.FallbackUrl != "" || plugin.CompareUrl != "" || plugin.Stdin) {
+		return sensu.CheckStateUnknown, errors.New("--kube-service can't be used with --hosts, --srv, --urls-file, --targets-file, --fallback-url, --compare-url or --stdin")
+	}
+	if plugin.ConsulService != "" && (len(plugin.Hosts) > 0 || plugin.Srv != "" || plugin.UrlsFile != "" || plugin.TargetsFile != "" || plugin.KubeService != "" || plugin.FallbackUrl != "" || plugin.CompareUrl != "" || plugin.Stdin) {
+		return sensu.CheckStateUnknown, errors.New("--consul-service can't be used with --hosts, --srv, --urls-file, --targets-file, --kube-service, --fallback-url, --compare-url or --stdin")
+	}
+	if len(plugin.ConsulTags) > 0 && plugin.ConsulService == "" {
+		return sensu.CheckStateUnknown, errors.New("--consul-tag requires --consul-service")
+	}
+	if plugin.KubePort != "" && plugin.KubeService == "" {
+		return sensu.CheckStateUnknown, errors.New("--kube-port requires --kube-service")
+	}
+	if plugin.FallbackUrl != "" && (len(plugin.Urls) > 1 || len(plugin.Hosts) > 0 || plugin.Srv != "" || plugin.UrlsFile != "") {
+		return sensu.CheckStateUnknown, errors.New("--fallback-url only applies to a single --url")
+	}
+	if plugin.CompareUrl != "" {
+		if plugin.FallbackUrl != "" || len(plugin.Urls) > 1 || len(plugin.Hosts) > 0 || plugin.Srv != "" || plugin.UrlsFile != "" {
+			return sensu.CheckStateUnknown, errors.New("--compare-url only applies to a single --url and can't be used with --fallback-url")
+		}
+		if plugin.CompareUrl == plugin.Urls[0] {
+			return sensu.CheckStateUnknown, errors.New("--compare-url must differ from --url")
+		}
+		if plugin.Expr != "" || plugin.MetricNumerator != "" || plugin.RulesFile != "" || plugin.CardinalityBy != "" {
+			return sensu.CheckStateUnknown, errors.New("--compare-url can't be used with --expr, --metric-numerator, --rules-file or --cardinality-by")
+		}
+	}
+	if len(plugin.Hosts) > 0 && (plugin.Srv != "" || plugin.UrlsFile != "") {
+		return sensu.CheckStateUnknown, errors.New("--hosts can't be combined with --srv or --urls-file")
+	}
+	if plugin.Tolerance < 0 {
+		return sensu.CheckStateUnknown, errors.New("--tolerance must not be negative")
+	}
+	if plugin.Port < 0 || plugin.Port > 65535 {
+		return sensu.CheckStateUnknown, errors.New("--port must be between 0 and 65535")
+	}
+	if deltaEnabled() && !stateConfigured() {
+		return sensu.CheckStateUnknown, errors.New("--delta-min and --delta-max require --state-file or --state-backend event")
+	}
+	if plugin.Condition != "" {
+		if _, err := parseCondition(plugin.Condition); err != nil {
+			return sensu.CheckStateUnknown, err
+		}
+	}
+	if _, err := parseOptionalRange(plugin.Critical); err != nil {
+		return sensu.CheckStateUnknown, err
+	}
+	if _, err := parseOptionalRange(plugin.Warning); err != nil {
+		return sensu.CheckStateUnknown, err
+	}
+	if plugin.MinCount < 0 || plugin.MaxCount < 0 {
+		return sensu.CheckStateUnknown, errors.New("--min-count and --max-count must not be negative")
+	}
+	if plugin.DeviationPercent < 0 {
+		return sensu.CheckStateUnknown, errors.New("--deviation-percent must not be negative")
+	}
+	if plugin.RequireChange && !stateConfigured() {
+		return sensu.CheckStateUnknown, errors.New("--require-change requires --state-file or --state-backend event")
+	}
+	if plugin.Rate {
+		if !stateConfigured() {
+			return sensu.CheckStateUnknown, errors.New("--rate requires --state-file or --state-backend event")
+		}
+		if deltaEnabled() || plugin.RequireChange {
+			return sensu.CheckStateUnknown, errors.New("--rate can't be used with --delta-min, --delta-max or --require-change")
+		}
+	}
+	if plugin.SampleInterval < 0 {
+		return sensu.CheckStateUnknown, errors.New("--sample-interval must not be negative")
+	}
+	if plugin.SampleInterval > 0 && (plugin.Rate || deltaEnabled() || plugin.RequireChange) {
+		return sensu.CheckStateUnknown, errors.New("--sample-interval can't be used with --rate, --delta-min, --delta-max or --require-change")
+	}
+	if plugin.Stdin && (len(plugin.Hosts) > 0 || plugin.Srv != "" || plugin.UrlsFile != "" || plugin.CompareUrl != "" || plugin.FallbackUrl != "") {
+		return sensu.CheckStateUnknown, errors.New("--stdin can't be used with --hosts, --srv, --urls-file, --compare-url or --fallback-url")
+	}
+	if plugin.Stdin && (plugin.Query != "" || plugin.SampleInterval > 0 || plugin.ConnectTest) {
+		return sensu.CheckStateUnknown, errors.New("--stdin can't be used with --query, --sample-interval or --connect-test")
+	}
+	if plugin.Body != "" && plugin.Method != "POST" {
+		return sensu.CheckStateUnknown, errors.New("--body requires --method POST")
+	}
+	if plugin.StateBackend == "event" && (plugin.SensuAPIKey == "" || plugin.SensuEntity == "" || plugin.SensuCheck == "") {
+		return sensu.CheckStateUnknown, errors.New("--state-backend event requires --sensu-api-key, --sensu-entity and --sensu-check")
+	}
+
+	return sensu.CheckStateOK, nil
+}
+func QueryExporter(exporterURL string, creds credentials, insecureSkipVerify bool, cert string, key string, cacert string) (model.Vector, error) {
+	metricFamilies, err := QueryMetricFamilies(exporterURL, creds, insecureSkipVerify, cert, key, cacert)
+	if err != nil {
+		return nil, err
+	}
+
+	return extractSamples(metricFamilies), nil
+}
+
+// extractSamples flattens metric families into samples, stamping samples that
+// don't expose a timestamp with the current time. Native histograms get
+// _bucket series like classic ones.
+func extractSamples(metricFamilies map[string]*dto.MetricFamily) model.Vector {
+	samples := model.Vector{}
+
+	decodeOptions := &expfmt.DecodeOptions{
+		Timestamp: model.Now(),
+	}
+
+	for _, family := range metricFamilies {
+		familySamples, _ := expfmt.ExtractSamples(decodeOptions, family)
+		samples = append(samples, familySamples...)
+		if family.GetType() == dto.MetricType_HISTOGRAM || family.GetType() == dto.MetricType_GAUGE_HISTOGRAM {
+			for _, metric := range family.GetMetric() {
+				samples = append(samples, nativeBuckets(family.GetName(), metric, decodeOptions.Timestamp)...)
+			}
+		}
+	}
+
+	return samples
+}
+
+// QueryMetricFamilies scrapes the exporter and returns the parsed metric
+// families, keyed by name.
+func QueryMetricFamilies(exporterURL string, creds credentials, insecureSkipVerify bool, cert string, key string, cacert string) (map[string]*dto.MetricFamily, error) {
+	exporterURL, err := addParams(exporterURL, plugin.Params)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug("scraping exporter", "url", exporterURL)
+	expResponse, err := fetch(exporterURL, plugin.Method, plugin.Body, acceptHeader, creds, insecureSkipVerify, cert, key, cacert)
+	if err != nil {
+		return nil, err
+	}
+	defer expResponse.Body.Close()
+
+	body, format := io.Reader(expResponse.Body), expfmt.ResponseFormat(expResponse.Header)
+	if isOpenMetrics(expResponse.Header) {
+		body, format = newOpenMetricsReader(body), expfmt.NewFormat(expfmt.TypeTextPlain)
+	}
+	metricFamilies, err := decodeFamilies(body, format, wantedMetrics())
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug("scraped exporter", "url", exporterURL, "families", len(metricFamilies))
+	return metricFamilies, nil
+}
+
+// cancelBody is the body of a response fetched within --timeout. Closing it
+// releases the timeout, and reading it past the timeout reports the timeout.
+type cancelBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	cancel context.CancelFunc
+	url    string
+}
+
+func (b *cancelBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && errors.Is(b.ctx.Err(), context.DeadlineExceeded) {
+		return n, fmt.Errorf("scraping %s timed out after %ds", b.url, plugin.Timeout)
+	}
+	return n, err
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// parseHeaders parses the --header values, given as "Name: value". A header
+// given more than once is sent with every value.
+func parseHeaders(values []string) (http.Header, error) {
+	headers := http.Header{}
+	for _, value := range values {
+		name, content, ok := strings.Cut(value, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid --header %q, expected Name: value", value)
+		}
+		headers.Add(name, strings.TrimSpace(content))
+	}
+	return headers, nil
+}
+
+// addParams returns target with the --param values, given as "name=value",
+// added to its query.
+func addParams(target string, params []string) (string, error) {
+	if len(params) == 0 {
+		return target, nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	query := []string{}
+	if u.RawQuery != "" {
+		query = append(query, u.RawQuery)
+	}
+	for _, param := range params {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok || name == "" {
+			return "", fmt.Errorf("invalid --param %q, expected name=value", param)
+		}
+		query = append(query, url.QueryEscape(name)+"="+url.QueryEscape(value))
+	}
+	u.RawQuery = strings.Join(query, "&")
+	return u.String(), nil
+}
+
+// proxyURL returns the proxy of the scrapes: --proxy-url when set, otherwise
+// the proxy set by the environment.
+func proxyURL() (func(*http.Request) (*url.URL, error), error) {
+	if plugin.ProxyUrl == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxy, err := url.Parse(plugin.ProxyUrl)
+	if err != nil || proxy.Scheme == "" || proxy.Host == "" {
+		return nil, fmt.Errorf("invalid --proxy-url %s", plugin.ProxyUrl)
+	}
+	return http.ProxyURL(proxy), nil
+}
+
+// nextTransportKey is the context key of the transport a round tripper shared
+// by the targets of a run sends a request with.
+type nextTransportKey struct{}
+
+// nextTransport sends the requests with the transport of their context.
+type nextTransport struct{}
+
+func (nextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return req.Context().Value(nextTransportKey{}).(http.RoundTripper).RoundTrip(req)
+}
+
+// sharedTransport sends the requests with a round tripper shared by the
+// targets of a run, such as one caching a token, which ends with nextTransport
+// so that they are sent on with the transport next of the target.
+type sharedTransport struct {
+	shared http.RoundTripper
+	next   http.RoundTripper
+}
+
+func (t *sharedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.shared.RoundTrip(req.WithContext(context.WithValue(req.Context(), nextTransportKey{}, t.next)))
+}
+
+// gzipBody decompresses a gzip encoded response body. Scrapes ask for gzip
+// themselves, the transports of HTTP config files don't.
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+// fetch sends a GET request for url accepting the accept media types, with
+// the configured TLS and authentication settings. It returns the response if
+// its status is OK, which the caller has to close.
+func fetch(url string, method string, body string, accept string, creds credentials, insecureSkipVerify bool, cert string, key string, cacert string) (*http.Response, error) {
+	tlsconfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+
+	if len(cert) > 0 || len(key) > 0 {
+		certpair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			logger.Error("could not load certificate or key", "cert", cert, "key", key, "err", err)
+			return nil, err
+		}
+		tlsconfig.Certificates = []tls.Certificate{certpair}
+	}
+	if len(cacert) > 0 {
+		cacertfile, err := os.ReadFile(cacert)
+		if err != nil {
+			logger.Error("could not load CA", "cacert", cacert, "err", err)
+			return nil, err
+		}
+		rootca := x509.NewCertPool()
+		rootca.AppendCertsFromPEM(cacertfile)
+		tlsconfig.RootCAs = rootca
+	}
+	tlsconfig.ServerName = plugin.ServerName
+	minVersion, err := parseTLSVersion(plugin.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+	tlsconfig.MinVersion = minVersion
+	if len(plugin.TLSCiphers) > 0 {
+		if tlsconfig.CipherSuites, err = parseCipherSuites(plugin.TLSCiphers); err != nil {
+			return nil, err
+		}
+	}
+
+	dialer := &net.Dialer{
+		Timeout: time.Duration(plugin.ConnectTimeout) * time.Second,
+	}
+	proxy, err := proxyURL()
+	if err != nil {
+		return nil, err
+	}
+	dial := dialer.DialContext
+	if plugin.Socks5 != "" {
+		if dial, err = socks5Dialer(dialer); err != nil {
+			return nil, err
+		}
+		proxy = nil
+	}
+	var rt http.RoundTripper
+	switch {
+	case strings.HasPrefix(url, "file://"):
+		rt = fileTransport{}
+	case strings.HasPrefix(url, "unix://") && plugin.httpConfig != nil:
+		rt, err = newUnixTransport(url, dialer, newHTTPConfigTransport)
+	case strings.HasPrefix(url, "unix://"):
+		rt, err = newUnixTransport(url, dialer, func(dial config.DialContextFunc) (http.RoundTripper, error) {
+			return &http.Transport{DialContext: dial}, nil
+		})
+	case plugin.httpConfig != nil:
+		rt, err = newHTTPConfigTransport(dial)
+	default:
+		rt = &http.Transport{TLSClientConfig: tlsconfig, DialContext: dial, Proxy: proxy}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if creds.OAuth2ClientID != "" {
+		if rt, err = newOAuth2Transport(creds, rt); err != nil {
+			return nil, err
+		}
+	}
+	if plugin.Sigv4Region != "" {
+		if rt, err = newSigV4Transport(plugin.Sigv4Region, rt); err != nil {
+			return nil, err
+		}
+	}
+	if plugin.GoogleAuth {
+		// Token endpoints are not the exporter, they don't get its TLS settings.
+		tokenClient := &http.Client{Transport: &http.Transport{DialContext: dial, Proxy: proxy}}
+		if rt, err = newGoogleTransport(tokenClient, rt); err != nil {
+			return nil, err
+		}
+	}
+	client := &http.Client{Transport: rt}
+	if plugin.httpConfig != nil && !plugin.httpConfig.FollowRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	}
+	user, password, token, err := creds.resolve(url)
+	if err != nil {
+		return nil, err
+	}
+
+	var delay time.Duration
+	if plugin.Retries > 0 {
+		if delay, err = time.ParseDuration(plugin.RetryDelay); err != nil {
+			return nil, fmt.Errorf("invalid --retry-delay %s", plugin.RetryDelay)
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		expResponse, err := send(client, url, method, body, accept, user, password, token)
+		if err == nil || attempt >= plugin.Retries || !retryable(err) {
+			return expResponse, err
+		}
+		logger.Warn("scrape failed, retrying", "url", url, "attempt", attempt+1, "delay", delay, "err", err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// send sends a single method request for url with client, within --timeout.
+// A body is sent as JSON when it is valid JSON and as form data otherwise,
+// unless --header sets its Content-Type.
+func send(client *http.Client, url string, method string, body string, accept string, user string, password string, token string) (*http.Response, error) {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if plugin.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(plugin.Timeout)*time.Second)
+	}
+	var payload io.Reader
+	if body != "" {
+		payload = strings.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, payload)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent())
+	if body != "" {
+		if json.Valid([]byte(body)) {
+			req.Header.Set("Content-Type", "application/json")
+		} else {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("Accept-Encoding", "gzip")
+	if user != "" && password != "" {
+		req.SetBasicAuth(user, password)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	headers, err := parseHeaders(plugin.Headers)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for name, values := range headers {
+		if name == "Host" {
+			req.Host = values[len(values)-1]
+			continue
+		}
+		req.Header[name] = values
+	}
+
+	expResponse, err := client.Do(req)
+	if err != nil {
+		cancel()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("scraping %s timed out after %ds", url, plugin.Timeout)
+		}
+		var opError *net.OpError
+		if errors.As(err, &opError) && opError.Op == "dial" && opError.Timeout() {
+			if plugin.ConnectTimeout == 0 {
+				return nil, fmt.Errorf("connecting to exporter timed out: %w", err)
+			}
+			return nil, fmt.Errorf("connecting to exporter timed out after %ds: %w", plugin.ConnectTimeout, err)
+		}
+		return nil, err
+	}
+	if expResponse.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(expResponse.Body, 64<<10))
+		expResponse.Body.Close()
+		cancel()
+		return nil, &StatusError{StatusCode: expResponse.StatusCode, Status: expResponse.Status, Body: body}
+	}
+	expResponse.Body = &cancelBody{ReadCloser: expResponse.Body, ctx: ctx, cancel: cancel, url: url}
+	if !expResponse.Uncompressed && strings.EqualFold(expResponse.Header.Get("Content-Encoding"), "gzip") {
+		reader, err := gzip.NewReader(expResponse.Body)
+		if err != nil {
+			expResponse.Body.Close()
+			return nil, fmt.Errorf("could not decompress response of %s: %v", url, err)
+		}
+		expResponse.Body = &gzipBody{Reader: reader, body: expResponse.Body}
+		expResponse.Header.Del("Content-Encoding")
+	}
+
+	return expResponse, nil
+}
+
+// retryable reports whether a failed scrape is worth retrying with --retries:
+// refused or reset connections and 5xx responses, as seen while an exporter
+// restarts. DNS, TLS and timeout failures are not retried.
+func retryable(err error) bool {
+	var statusError *StatusError
+	if errors.As(err, &statusError) {
+		return statusError.StatusCode >= http.StatusInternalServerError
+	}
+	var dnsError *net.DNSError
+	if errors.As(err, &dnsError) {
+		return false
+	}
+	var opError *net.OpError
+	if errors.As(err, &opError) {
+		return !opError.Timeout()
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+func evaluateCheck(event *corev2.Event) (int, error) {
+
+	var samples, compared model.Vector
+	var err error
+
+	if plugin.ActiveWindow != "" {
+		window, err := parseActiveWindow(plugin.ActiveWindow)
+		if err != nil {
+			printf("Failed: %s\n", err)
+			return sensu.CheckStateUnknown, nil
+		}
+		location, err := time.LoadLocation(plugin.Timezone)
+		if err != nil {
+			printf("Failed: %s\n", err)
+			return sensu.CheckStateUnknown, nil
+		}
+		if !window.contains(time.Now().In(location)) {
+			printf("Outside of active window %s, thresholds are not checked\n", plugin.ActiveWindow)
+			return checkStates[plugin.InactiveState], nil
+		}
+	}
+
+	targets := append([]string{}, plugin.Urls...)
+	if plugin.Stdin {
+		targets = []string{stdinTarget}
+	}
+	if len(plugin.Hosts) > 0 {
+		targets = hostTargets(plugin.Hosts, plugin.Scheme, plugin.Port, plugin.Path)
+	}
+	if plugin.Srv != "" {
+		targets, err = resolveSRV(plugin.Srv, plugin.Scheme, plugin.Path, plugin.SrvAll)
+		if err != nil {
+			printf("Failed: %s\n", err)
+			return sensu.CheckStateUnknown, nil
+		}
+	}
+	if plugin.UrlsFile != "" {
+		targets, err = readTargets(plugin.UrlsFile)
+		if err != nil {
+			printf("Failed: %s\n", err)
+			return sensu.CheckStateUnknown, nil
+		}
+		targets = hostTargets(targets, plugin.Scheme, plugin.Port, plugin.Path)
+	}
+	var targetLabels map[string]model.LabelSet
+	if plugin.TargetsFile != "" {
+		targets, targetLabels, err = readFileSD(plugin.TargetsFile, plugin.Scheme, plugin.Port, plugin.Path)
+		if err != nil {
+			printf("Failed: %s\n", err)
+			return sensu.CheckStateUnknown, nil
+		}
+	}
+	if plugin.KubeService != "" {
+		targets, targetLabels, err = resolveKubeService(plugin.KubeService, plugin.KubePort, plugin.Scheme, plugin.Path)
+		if err != nil {
+			printf("Failed: %s\n", err)
+			return sensu.CheckStateUnknown, nil
+		}
+	}
+	if plugin.ConsulService != "" {
+		targets, targetLabels, err = resolveConsulService(plugin.ConsulAddr, plugin.ConsulToken, plugin.ConsulService, plugin.ConsulTags, plugin.Scheme, plugin.Path)
+		if err != nil {
+			printf("Failed: %s\n", err)
+			return sensu.CheckStateUnknown, nil
+		}
+	}
+	multiple := len(targets) > 1
+	if plugin.CompareUrl != "" {
+		targets = append(targets, plugin.CompareUrl)
+	}
+	if plugin.ConnectTest {
+		return connectTest(targets), nil
+	}
+	start := time.Now()
+	results := sampleTargets(targets, plugin.Concurrency)
+	if plugin.FallbackUrl != "" && len(results) == 1 && results[0].Err != nil {
+		logger.Info("scraping failed, trying fallback URL", "url", results[0].Target, "fallback", plugin.FallbackUrl, "err", results[0].Err)
+		fallback := sampleTargets([]string{plugin.FallbackUrl}, 1)[0]
+		if fallback.Err == nil {
+			results = []scrapeResult{fallback}
+		} else {
+			results = append(results, fallback)
+		}
+	}
+	if report != nil {
+		report.ScrapeDuration = time.Since(start).Seconds()
+	}
+	for _, result := range results {
+		if result.Err == nil {
+			logger.Info("using exporter", "url", result.Target)
+		}
+	}
+	duplicates := map[string]int{}
+	failed := false
+	for _, result := range results {
+		if result.Err != nil {
+			printf("Failed: %s\n", result.Err)
+			failed = true
+		}
+	}
+	if failed {
+		return sensu.CheckStateUnknown, nil
+	}
+	if plugin.ExpectType != "" {
+		for _, result := range results {
+			for name, family := range result.Families {
+				if !metricSelected(name) {
+					continue
+				}
+				if metricType := strings.ToLower(family.GetType().String()); metricType != plugin.ExpectType {
+					printf("%s: metric %s is declared as %s. Check expect %s\n", result.Target, name, metricType, plugin.ExpectType)
+					return sensu.CheckStateUnknown, nil
+				}
+			}
+		}
+	}
+	counters := map[string]bool{}
+	for _, result := range results {
+		for name, family := range result.Families {
+			if family.GetType() == dto.MetricType_COUNTER {
+				counters[name] = true
+			}
+		}
+		if len(result.Families) == 0 && plugin.Query == "" {
+			printf("%s: exporter returned 200 but no metrics\n", result.Target)
+			return checkStates[plugin.EmptyState], nil
+		}
+		addTargetLabels(result.Samples, targetLabels[result.Target])
+		if multiple {
+			addInstanceLabel(result.Samples, result.Target)
+		}
+		targetSamples, targetDuplicates := dedupeSamples(result.Samples)
+		for series, count := range targetDuplicates {
+			duplicates[series] = count
+		}
+		if plugin.Quantile != math.Pi {
+			for _, metric := range plugin.Metrics {
+				targetSamples, err = selectQuantile(targetSamples, result.Families, metric, plugin.Quantile)
+				if err != nil {
+					printf("%s: %s\n", result.Target, err)
+					return sensu.CheckStateUnknown, nil
+				}
+			}
+		}
+		if plugin.SummaryQuantile != math.Pi {
+			for _, metric := range plugin.Metrics {
+				targetSamples = summaryQuantile(targetSamples, metric, plugin.SummaryQuantile)
+			}
+		}
+		if plugin.BucketLe != math.Pi {
+			for _, metric := range plugin.Metrics {
+				targetSamples = bucketFraction(targetSamples, metric, plugin.BucketLe)
+			}
+		}
+		if plugin.CompareUrl != "" && result.Target == plugin.CompareUrl {
+			compared = targetSamples
+			continue
+		}
+		samples = append(samples, targetSamples...)
+	}
+	if plugin.RulesFile != "" {
+		rules, err := loadRules(plugin.RulesFile)
+		if err != nil {
+			printf("Failed: %s\n", err)
+			return sensu.CheckStateUnknown, nil
+		}
+		return rulesReport(rules, samples), nil
+	}
+	matchers, err := parseLabelMatchers(plugin.Labels, plugin.LabelCI)
+	if err != nil {
+		printf("Failed: %s\n", err)
+		return sensu.CheckStateUnknown, nil
+	}
+	excludes, err := parseExcludes(plugin.Excludes)
+	if err != nil {
+		printf("Failed: %s\n", err)
+		return sensu.CheckStateUnknown, nil
+	}
+	matched := model.Vector{}
+	duplicated := false
+	dropped := 0
+	for _, value := range samples {
+		if metricSelected(string(value.Metric[model.MetricNameLabel])) && matchLabels(value.Metric, matchers, plugin.LabelMatch == "any") {
+			if excluded(value.Metric, excludes) {
+				dropped += 1
+				continue
+			}
+			if count, ok := duplicates[value.Metric.String()]; ok {
+				printf("Metric %s is exposed %d times, using the last value\n", seriesName(value.Metric), count)
+				duplicated = true
+			}
+			matched = append(matched, value)
+		}
+	}
+	if plugin.Collect {
+		for _, value := range matched {
+			printLine(metricPoint(value.Metric, float64(value.Value), time.Now()))
+		}
+		return sensu.CheckStateOK, nil
+	}
+	if plugin.CardinalityBy != "" {
+		return cardinalityReport(matched, plugin.CardinalityBy, plugin.CountMax), nil
+	}
+	checked := metricSelector()
+	if plugin.Expr != "" {
+		checked = plugin.Expr
+		expr, err := parseExpr(plugin.Expr)
+		if err != nil {
+			printf("Failed: %s\n", err)
+			return sensu.CheckStateUnknown, nil
+		}
+		matched, err = evaluateExpr(plugin.Expr, expr, samples, matchers, plugin.LabelMatch == "any")
+		if err != nil {
+			printf("Failed: %s\n", err)
+			return sensu.CheckStateUnknown, nil
+		}
+	}
+	if plugin.MetricNumerator != "" {
+		checked = plugin.MetricNumerator + " / " + plugin.MetricDenominator
+		matched, err = ratioSamples(matched, plugin.MetricNumerator, plugin.MetricDenominator, plugin.RatioOn)
+		if err != nil {
+			printf("Failed: %s\n", err)
+			return sensu.CheckStateUnknown, nil
+		}
+	}
+	if plugin.CompareUrl != "" {
+		others := model.Vector{}
+		for _, value := range compared {
+			if metricSelected(string(value.Metric[model.MetricNameLabel])) && matchLabels(value.Metric, matchers, plugin.LabelMatch == "any") && !excluded(value.Metric, excludes) {
+				others = append(others, value)
+			}
+		}
+		matched = compareSamples(matched, others, plugin.CompareUrl, plugin.Compare)
+	}
+	logger.Debug("selected series", "metric", checked, "series", len(matched))
+	if report != nil {
+		report.Metric = checked
+	}
+	if dropped > 0 {
+		printf("Excluded %d series of metric %s\n", dropped, checked)
+	}
+	if plugin.Absent {
+		return absentReport(matched, checked), nil
+	}
+	countStatus := sensu.CheckStateOK
+	if plugin.MinCount > 0 && len(matched) < plugin.MinCount {
+		printf("Metric %s has %d series. Check require at least %d\n", checked, len(matched), plugin.MinCount)
+		countStatus = sensu.CheckStateCritical
+	}
+	if plugin.MaxCount > 0 && len(matched) > plugin.MaxCount {
+		printf("Metric %s has %d series. Check require at most %d\n", checked, len(matched), plugin.MaxCount)
+		countStatus = sensu.CheckStateCritical
+	}
+	if len(matched) == 0 {
+		printf("Metric %s not found\n", checked)
+		return worstState(checkStates[plugin.MissingState], countStatus), nil
+	}
+	missing := []string{}
+	if plugin.Expr == "" && plugin.CompareUrl == "" {
+		missing = missingMetrics(matched)
+		for _, metric := range missing {
+			printf("Metric %s not found\n", metric)
+		}
+	}
+	required, err := parseRequiredLabels(plugin.RequireLabels)
+	if err != nil {
+		printf("Failed: %s\n", err)
+		return sensu.CheckStateUnknown, nil
+	}
+	coverage := []failure{}
+	for _, missing := range missingLabelValues(matched, required) {
+		coverage = append(coverage, failure{sensu.CheckStateCritical, fmt.Sprintf("Metric %s has no series with %s", checked, missing), 0})
+	}
+	if plugin.Aggregate != "" {
+		matched = aggregateSamples(matched, checked, plugin.GroupBy, plugin.Aggregate)
+	}
+
+	var state, previousState map[string]seriesState
+	store := newStateStore()
+	if deltaEnabled() || plugin.RequireChange || plugin.Rate {
+		previousState, err = store.load()
+		if err != nil {
+			printf("Failed: %s\n", err)
+			return sensu.CheckStateUnknown, nil
+		}
+		state = map[string]seriesState{}
+	}
+	if plugin.Rate {
+		matched = counterRates(matched, previousState, state, time.Now())
+	}
+
+	critical, err := parseOptionalRange(plugin.Critical)
+	if err != nil {
+		printf("Failed: %s\n", err)
+		return sensu.CheckStateUnknown, nil
+	}
+	warning, err := parseOptionalRange(plugin.Warning)
+	if err != nil {
+		printf("Failed: %s\n", err)
+		return sensu.CheckStateUnknown, nil
+	}
+	var condition condNode
+	if plugin.Condition != "" {
+		condition, err = parseCondition(plugin.Condition)
+		if err != nil {
+			printf("Failed: %s\n", err)
+			return sensu.CheckStateUnknown, nil
+		}
+	}
+
+	var baseline map[string]float64
+	if plugin.BaselineFile != "" {
+		baseline, err = loadBaseline(plugin.BaselineFile)
+		if err != nil {
+			printf("Failed: %s\n", err)
+			return sensu.CheckStateUnknown, nil
+		}
+	}
+
+	var outputTemplate *template.Template
+	if plugin.OutputTemplate != "" {
+		outputTemplate, err = parseOutputTemplate(plugin.OutputTemplate)
+		if err != nil {
+			printf("Failed: %s\n", err)
+			return sensu.CheckStateUnknown, nil
+		}
+	}
+
+	scaleFactor := plugin.Scale / units[plugin.Unit]
+	staleBefore := time.Now().Add(-time.Duration(plugin.MaxAge) * time.Second)
+	failures := []failure{}
+	perf := []string{}
+	points := []string{}
+	healthy := 0
+	for i, value := range matched {
+		progress.record(failures, i, len(matched))
+		breaches := len(failures)
+		series := seriesName(value.Metric)
+		if math.IsNaN(float64(value.Value)) {
+			failures = append(failures, failure{checkStates[plugin.NaNState], fmt.Sprintf("Metric %s is NaN", series), 0})
+			if outputTemplate != nil {
+				templateFailures(outputTemplate, value.Metric, float64(value.Value), failures[breaches:])
+			}
+			recordSeries(value.Metric, float64(value.Value), failures[breaches:])
+			continue
+		}
+		if plugin.MaxAge > 0 && value.Timestamp.Time().Before(staleBefore) {
+			failures = append(failures, failure{checkStates[plugin.StaleState], fmt.Sprintf("Metric %s is stale, last updated %s", series, value.Timestamp.Time().Format(time.RFC3339)), 0})
+			if outputTemplate != nil {
+				templateFailures(outputTemplate, value.Metric, float64(value.Value), failures[breaches:])
+			}
+			recordSeries(value.Metric, float64(value.Value), failures[breaches:])
+			continue
+		}
+		if plugin.CheckUp && value.Value != 1 {
+			failures = append(failures, failure{sensu.CheckStateCritical, fmt.Sprintf("Target %s is down", series), 0})
+		}
+		raw := float64(value.Value)
+		if plugin.AgeOf {
+			raw = float64(time.Now().UnixNano())/1e9 - raw
+		}
+		scaled := raw * scaleFactor
+		name := string(value.Metric[model.MetricNameLabel])
+		if plugin.AgeOf {
+			name = "age_seconds"
+		}
+		at := formatScaled(raw, scaled, name)
+		perf = append(perf, perfdata(series, scaled))
+		points = append(points, metricPoint(value.Metric, scaled, time.Now()))
+		if plugin.AgeOf && plugin.Humanize {
+			at = fmt.Sprintf("an age of %s", at)
+		} else if plugin.AgeOf {
+			at = fmt.Sprintf("an age of %s seconds", at)
+		}
+		if plugin.Rate || plugin.SampleInterval > 0 {
+			at = fmt.Sprintf("a rate of %s per second", at)
+		}
+		if plugin.Value != math.Pi && math.Abs(scaled-plugin.Value) > plugin.Tolerance {
+			failures = append(failures, failure{sensu.CheckStateCritical, fmt.Sprintf("Metric %s is at %s. Check require value %s", series, at, formatThreshold(plugin.Value, name)), breach(scaled, plugin.Value)})
+		} else if plugin.WarnValue != math.Pi && math.Abs(scaled-plugin.WarnValue) > plugin.Tolerance {
+			failures = append(failures, failure{sensu.CheckStateWarning, fmt.Sprintf("Metric %s is at %s. Check warn value %s", series, at, formatThreshold(plugin.WarnValue, name)), breach(scaled, plugin.WarnValue)})
+		}
+		if plugin.Min != math.Pi && scaled < plugin.Min {
+			failures = append(failures, failure{sensu.CheckStateCritical, fmt.Sprintf("Metric %s is at %s. Check require minimum %s", series, at, formatThreshold(plugin.Min, name)), breach(scaled, plugin.Min)})
+		} else if plugin.WarnMin != math.Pi && scaled < plugin.WarnMin {
+			failures = append(failures, failure{sensu.CheckStateWarning, fmt.Sprintf("Metric %s is at %s. Check warn minimum %s", series, at, formatThreshold(plugin.WarnMin, name)), breach(scaled, plugin.WarnMin)})
+		}
+		if plugin.Max != math.Pi && scaled > plugin.Max {
+			failures = append(failures, failure{sensu.CheckStateCritical, fmt.Sprintf("Metric %s is at %s. Check require maximum %s", series, at, formatThreshold(plugin.Max, name)), breach(scaled, plugin.Max)})
+		} else if plugin.WarnMax != math.Pi && scaled > plugin.WarnMax {
+			failures = append(failures, failure{sensu.CheckStateWarning, fmt.Sprintf("Metric %s is at %s. Check warn maximum %s", series, at, formatThreshold(plugin.WarnMax, name)), breach(scaled, plugin.WarnMax)})
+		}
+		if condition != nil {
+			holds, err := condition.holds(scaled)
+			if err != nil {
+				printf("Failed: %s\n", err)
+				return sensu.CheckStateUnknown, nil
+			}
+			if !holds {
+				failures = append(failures, failure{sensu.CheckStateCritical, fmt.Sprintf("Metric %s is at %s. Check require condition %s", series, at, plugin.Condition), 0})
+			}
+		}
+		if critical != nil && critical.alerts(scaled) {
+			failures = append(failures, failure{sensu.CheckStateCritical, fmt.Sprintf("Metric %s is at %s. Check require range %s", series, at, plugin.Critical), 0})
+		} else if warning != nil && warning.alerts(scaled) {
+			failures = append(failures, failure{sensu.CheckStateWarning, fmt.Sprintf("Metric %s is at %s. Check warn range %s", series, at, plugin.Warning), 0})
+		}
+		if baseline != nil {
+			if expected, ok := baseline[value.Metric.String()]; !ok {
+				failures = append(failures, failure{checkStates[plugin.NoBaselineState], fmt.Sprintf("Metric %s has no baseline", series), 0})
+			} else if deviation := deviationPercent(float64(value.Value), expected); deviation > plugin.DeviationPercent {
+				failures = append(failures, failure{sensu.CheckStateCritical, fmt.Sprintf("Metric %s is at %f, %.1f%% from its baseline %f. Check require at most %.1f%%", series, float64(value.Value), deviation, expected, plugin.DeviationPercent), deviation / 100})
+			}
+		}
+		if state != nil && !plugin.Rate {
+			key := value.Metric.String()
+			now := time.Now().Unix()
+			changed := now
+			if previous, ok := previousState[key]; ok {
+				rawDelta := float64(value.Value) - previous.Value
+				if counters[string(value.Metric[model.MetricNameLabel])] {
+					rawDelta = counterDelta(float64(value.Value), previous.Value)
+				}
+				delta := rawDelta * scaleFactor
+				if plugin.DeltaMin != math.Pi && delta < plugin.DeltaMin {
+					failures = append(failures, failure{sensu.CheckStateCritical, fmt.Sprintf("Metric %s changed by %s since last check. Check require minimum change %s", series, formatScaled(rawDelta, delta, name), formatThreshold(plugin.DeltaMin, name)), breach(delta, plugin.DeltaMin)})
+				}
+				if plugin.DeltaMax != math.Pi && delta > plugin.DeltaMax {
+					failures = append(failures, failure{sensu.CheckStateCritical, fmt.Sprintf("Metric %s changed by %s since last check. Check require maximum change %s", series, formatScaled(rawDelta, delta, name), formatThreshold(plugin.DeltaMax, name)), breach(delta, plugin.DeltaMax)})
+				}
+				if float64(value.Value) == previous.Value {
+					changed = previous.changedAt()
+					if plugin.RequireChange {
+						stuck := time.Duration(now-changed) * time.Second
+						failures = append(failures, failure{sensu.CheckStateCritical, fmt.Sprintf("Metric %s is stuck at %s for %s. Check require a change", series, at, stuck), 0})
+					}
+				}
+			}
+			state[key] = seriesState{Value: float64(value.Value), Timestamp: now, Changed: changed}
+		}
+		if outputTemplate != nil {
+			templateFailures(outputTemplate, value.Metric, scaled, failures[breaches:])
+		}
+		recordSeries(value.Metric, scaled, failures[breaches:])
+		if len(failures) == breaches {
+			healthy += 1
+		}
+		if plugin.FailFast && criticalSince(failures, breaches) {
+			logger.Debug("stopping at first critical series", "series", series, "skipped", len(matched)-i-1)
+			if state != nil && !plugin.Rate {
+				// Keep the state of skipped series for the next run.
+				for _, skipped := range matched[i+1:] {
+					if previous, ok := previousState[skipped.Metric.String()]; ok {
+						state[skipped.Metric.String()] = previous
+					}
+				}
+			}
+			break
+		}
+	}
+	failures = append(coverage, failures...)
+	if state != nil {
+		if err := store.save(state); err != nil {
+			printf("Failed: %s\n", err)
+			return sensu.CheckStateUnknown, nil
+		}
+	}
+	sortFailures(failures, plugin.SortBy)
+	if plugin.WorstOnly {
+		printFailures(worstFailure(failures), plugin.MaxFailures)
+	} else {
+		printFailures(failures, plugin.MaxFailures)
+	}
+	status := sensu.CheckStateOK
+	if plugin.MinHealthy > 0 {
+		if healthy < plugin.MinHealthy {
+			printf("%d of %d series of metric %s are healthy. Check require at least %d\n", healthy, len(matched), checked, plugin.MinHealthy)
+			status = sensu.CheckStateCritical
+		} else {
+			printf("%d of %d series of metric %s are healthy\n", healthy, len(matched), checked)
+		}
+		for _, failure := range coverage {
+			status = worstState(status, failure.State)
+		}
+	} else if len(failures) > 0 {
+		for _, failure := range failures {
+			status = worstState(status, failure.State)
+		}
+	} else {
+		printf("Metric %s is within required value\n", checked)
+	}
+	if duplicated {
+		status = worstState(status, checkStates[plugin.DuplicateState])
+	}
+	if len(missing) > 0 {
+		status = worstState(status, checkStates[plugin.MissingState])
+	}
+	status = worstState(status, countStatus)
+	if plugin.Perfdata && len(perf) > 0 {
+		printf("| %s\n", strings.Join(perf, " "))
+	}
+	if plugin.OutputMetrics {
+		for _, point := range points {
+			printLine(point)
+		}
+	}
+	return status, nil
+}
+
+// absentReport returns critical when no series matched, or when any --metric
+// has no series, and OK when every metric is present.
+func absentReport(matched model.Vector, checked string) int {
+	if len(matched) == 0 {
+		printf("Metric %s not found\n", checked)
+		return sensu.CheckStateCritical
+	}
+	missing := []string{}
+	if plugin.Expr == "" && plugin.CompareUrl == "" {
+		missing = missingMetrics(matched)
+	}
+	for _, metric := range missing {
+		printf("Metric %s not found\n", metric)
+	}
+	if len(missing) > 0 {
+		return sensu.CheckStateCritical
+	}
+	printf("Metric %s is present\n", checked)
+	return sensu.CheckStateOK
+}
+
+// formatScaled formats a value of the metric called name for output, adding
+// the raw value when it was scaled.
+func formatScaled(raw float64, scaled float64, name string) string {
+	if plugin.Humanize {
+		return humanize(scaled, name)
+	}
+	if raw == scaled {
+		return fmt.Sprintf("%f", scaled)
+	}
+	unit := ""
+	if plugin.Unit != "" {
+		unit = " " + plugin.Unit
+	}
+	return fmt.Sprintf("%f%s (raw %f)", scaled, unit, raw)
+}
+
+// formatThreshold formats a threshold on the metric called name for output.
+func formatThreshold(threshold float64, name string) string {
+	if plugin.Humanize {
+		return humanize(threshold, name)
+	}
+	return fmt.Sprintf("%f", threshold)
+}
+
+// warnEnabled reports whether any warning threshold is configured.
+func warnEnabled() bool {
+	return plugin.WarnMin != math.Pi || plugin.WarnMax != math.Pi || plugin.WarnValue != math.Pi
+}
+
+// deltaEnabled reports whether thresholds on the change since the previous run
+// are configured.
+func deltaEnabled() bool {
+	return plugin.DeltaMin != math.Pi || plugin.DeltaMax != math.Pi
 }
@@ -1,8 +1,1155 @@
 package main
 
 import (
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/sensu/sensu-plugin-sdk/sensu"
 )
 
 func TestMain(t *testing.T) {
 }
+
+// setupPlugin points the plugin config at a test exporter serving body and
+// restores the previous config once the test is done.
+func setupPlugin(t *testing.T, body string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	saved := plugin
+	t.Cleanup(func() { plugin = saved })
+	plugin.Urls = []string{server.URL}
+	plugin.Min, plugin.Max, plugin.Value = math.Pi, math.Pi, math.Pi
+	plugin.WarnMin, plugin.WarnMax, plugin.WarnValue = math.Pi, math.Pi, math.Pi
+	plugin.DeltaMin, plugin.DeltaMax = math.Pi, math.Pi
+	plugin.Concurrency = 1
+	plugin.Scale = 1
+	plugin.Quantile, plugin.SummaryQuantile, plugin.BucketLe = math.Pi, math.Pi, math.Pi
+	plugin.LogLevel = "error"
+}
+
+const upMetrics = `# TYPE up gauge
+up{instance="a"} 1
+up{instance="b"} 1
+up{instance="c"} 0
+`
+
+func TestExecuteCheckMinHealthy(t *testing.T) {
+	setupPlugin(t, upMetrics)
+	plugin.Metrics = []string{"up"}
+	plugin.Value = 1
+
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateCritical {
+		t.Fatalf("expected critical without quorum, got %d (%v)", status, err)
+	}
+
+	plugin.MinHealthy = 2
+	status, err = executeCheck(nil)
+	if err != nil || status != sensu.CheckStateOK {
+		t.Fatalf("expected OK with 2 of 3 healthy, got %d (%v)", status, err)
+	}
+
+	plugin.MinHealthy = 3
+	status, err = executeCheck(nil)
+	if err != nil || status != sensu.CheckStateCritical {
+		t.Fatalf("expected critical with 2 of 3 healthy, got %d (%v)", status, err)
+	}
+}
+
+func TestExecuteCheckEmptyBody(t *testing.T) {
+	setupPlugin(t, "  \n")
+	plugin.Metrics = []string{"up"}
+	plugin.Value = 1
+	plugin.EmptyState = "unknown"
+
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateUnknown {
+		t.Fatalf("expected unknown for an empty body, got %d (%v)", status, err)
+	}
+
+	plugin.EmptyState = "critical"
+	status, err = executeCheck(nil)
+	if err != nil || status != sensu.CheckStateCritical {
+		t.Fatalf("expected critical for an empty body, got %d (%v)", status, err)
+	}
+}
+
+func TestExecuteCheckUp(t *testing.T) {
+	setupPlugin(t, upMetrics)
+	plugin.CheckUp = true
+
+	if _, err := checkArgs(nil); err != nil {
+		t.Fatal(err)
+	}
+	out := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Errorf("expected critical with a target down, got %d (%v)", status, err)
+		}
+	})
+	if out != "Target up{instance=\"c\"} is down\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestExecuteCheckDelta(t *testing.T) {
+	setupPlugin(t, "errors_total 100\n")
+	plugin.Metrics = []string{"errors_total"}
+	plugin.StateFile = filepath.Join(t.TempDir(), "state.json")
+	plugin.DeltaMax = 10
+
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateOK {
+		t.Fatalf("expected OK on first run, got %d (%v)", status, err)
+	}
+	if err := saveState(plugin.StateFile, map[string]seriesState{"errors_total": {Value: 50}}); err != nil {
+		t.Fatal(err)
+	}
+	status, err = executeCheck(nil)
+	if err != nil || status != sensu.CheckStateCritical {
+		t.Fatalf("expected critical after growing by 50, got %d (%v)", status, err)
+	}
+	status, err = executeCheck(nil)
+	if err != nil || status != sensu.CheckStateOK {
+		t.Fatalf("expected OK without change, got %d (%v)", status, err)
+	}
+}
+
+func TestExecuteCheckDeltaGauge(t *testing.T) {
+	setupPlugin(t, "# TYPE queue_size gauge\nqueue_size 50\n# TYPE errors_total counter\nerrors_total 50\n")
+	plugin.Metrics = []string{"queue_size"}
+	plugin.StateFile = filepath.Join(t.TempDir(), "state.json")
+	plugin.DeltaMin = -10
+
+	if err := saveState(plugin.StateFile, map[string]seriesState{"queue_size": {Value: 100}}); err != nil {
+		t.Fatal(err)
+	}
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateCritical {
+		t.Fatalf("expected critical after a gauge fell by 50, got %d (%v)", status, err)
+	}
+
+	plugin.Metrics = []string{"errors_total"}
+	if err := saveState(plugin.StateFile, map[string]seriesState{"errors_total": {Value: 100}}); err != nil {
+		t.Fatal(err)
+	}
+	status, err = executeCheck(nil)
+	if err != nil || status != sensu.CheckStateOK {
+		t.Fatalf("expected a counter reset to count as growth, got %d (%v)", status, err)
+	}
+}
+
+func TestExecuteCheckRate(t *testing.T) {
+	setupPlugin(t, "errors_total 100\n")
+	plugin.Metrics = []string{"errors_total"}
+	plugin.StateFile = filepath.Join(t.TempDir(), "state.json")
+	plugin.Rate = true
+	plugin.Max = 1
+
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateOK {
+		t.Fatalf("expected OK on first run, got %d (%v)", status, err)
+	}
+	since := time.Now().Unix() - 10
+	if err := saveState(plugin.StateFile, map[string]seriesState{"errors_total": {Value: 50, Timestamp: since}}); err != nil {
+		t.Fatal(err)
+	}
+	out := captureOutput(t, func() {
+		status, err = executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical at 5 per second, got %d (%v)", status, err)
+		}
+	})
+	if !strings.HasPrefix(out, "Metric errors_total is at a rate of ") {
+		t.Errorf("unexpected output %q", out)
+	}
+	state, err := loadState(plugin.StateFile)
+	if err != nil || state["errors_total"].Value != 100 {
+		t.Errorf("expected the raw counter in the state file, got %v (%v)", state, err)
+	}
+}
+
+func TestExecuteCheckUnit(t *testing.T) {
+	setupPlugin(t, "node_memory_bytes 12884901888\n")
+	plugin.Metrics = []string{"node_memory_bytes"}
+	plugin.Unit = "Gi"
+	plugin.Max = 10
+
+	out := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Errorf("expected critical above 10Gi, got %d (%v)", status, err)
+		}
+	})
+	if out != "Metric node_memory_bytes is at 12.000000 Gi (raw 12884901888.000000). Check require maximum 10.000000\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestExecuteCheckDuplicates(t *testing.T) {
+	setupPlugin(t, "up{instance=\"a\"} 0\nup{instance=\"a\"} 1\n")
+	plugin.Metrics = []string{"up"}
+	plugin.Value = 1
+	plugin.DuplicateState = "ok"
+
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateOK {
+		t.Fatalf("expected OK using the last value, got %d (%v)", status, err)
+	}
+
+	plugin.DuplicateState = "warning"
+	status, err = executeCheck(nil)
+	if err != nil || status != sensu.CheckStateWarning {
+		t.Fatalf("expected warning for a duplicated series, got %d (%v)", status, err)
+	}
+}
+
+func TestExecuteCheckStates(t *testing.T) {
+	setupPlugin(t, "queue_depth{queue=\"a\"} NaN\nqueue_depth{queue=\"b\"} 3 1000\n")
+	plugin.Metrics = []string{"queue_depth"}
+	plugin.Max = 10
+	plugin.MissingState, plugin.StaleState, plugin.NaNState = "warning", "critical", "unknown"
+
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateUnknown {
+		t.Fatalf("expected unknown for a NaN series, got %d (%v)", status, err)
+	}
+
+	plugin.NaNState = "ok"
+	plugin.MaxAge = 60
+	status, err = executeCheck(nil)
+	if err != nil || status != sensu.CheckStateCritical {
+		t.Fatalf("expected critical for a stale series, got %d (%v)", status, err)
+	}
+
+	plugin.Metrics = []string{"missing"}
+	status, err = executeCheck(nil)
+	if err != nil || status != sensu.CheckStateWarning {
+		t.Fatalf("expected warning for a missing metric, got %d (%v)", status, err)
+	}
+}
+
+func TestExecuteCheckExpectType(t *testing.T) {
+	setupPlugin(t, upMetrics)
+	plugin.Metrics = []string{"up"}
+	plugin.Value = 1
+	plugin.MinHealthy = 1
+
+	plugin.ExpectType = "gauge"
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateOK {
+		t.Fatalf("expected OK for a gauge, got %d (%v)", status, err)
+	}
+
+	plugin.ExpectType = "counter"
+	status, err = executeCheck(nil)
+	if err != nil || status != sensu.CheckStateUnknown {
+		t.Fatalf("expected unknown for a gauge expected to be a counter, got %d (%v)", status, err)
+	}
+}
+
+func TestExecuteCheckAgeOf(t *testing.T) {
+	setupPlugin(t, fmt.Sprintf("last_processed_timestamp_seconds %d\n", time.Now().Add(-10*time.Minute).Unix()))
+	plugin.Metrics = []string{"last_processed_timestamp_seconds"}
+	plugin.AgeOf = true
+
+	plugin.Max = 300
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateCritical {
+		t.Fatalf("expected critical for a 10 minutes old timestamp, got %d (%v)", status, err)
+	}
+
+	plugin.Max = 900
+	status, err = executeCheck(nil)
+	if err != nil || status != sensu.CheckStateOK {
+		t.Fatalf("expected OK for a 10 minutes old timestamp, got %d (%v)", status, err)
+	}
+}
+
+func TestExecuteCheckExpr(t *testing.T) {
+	setupPlugin(t, "http_errors_total 5\nhttp_requests_total 200\n")
+	plugin.Expr = "http_errors_total / http_requests_total"
+	plugin.Max = 0.01
+
+	if _, err := checkArgs(nil); err != nil {
+		t.Fatal(err)
+	}
+	out := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Errorf("expected critical for a 2.5%% error ratio, got %d (%v)", status, err)
+		}
+	})
+	if out != "Metric http_errors_total / http_requests_total is at 0.025000. Check require maximum 0.010000\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestExecuteCheckRequireChange(t *testing.T) {
+	setupPlugin(t, "pipeline_processed_total 42\n")
+	plugin.Metrics = []string{"pipeline_processed_total"}
+	plugin.StateFile = filepath.Join(t.TempDir(), "state.json")
+	plugin.RequireChange = true
+
+	if err := saveState(plugin.StateFile, map[string]seriesState{"pipeline_processed_total": {Value: 41, Timestamp: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateOK {
+		t.Fatalf("expected OK after a change, got %d (%v)", status, err)
+	}
+
+	stuckSince := time.Now().Add(-time.Hour).Unix()
+	if err := saveState(plugin.StateFile, map[string]seriesState{"pipeline_processed_total": {Value: 42, Timestamp: 1, Changed: stuckSince}}); err != nil {
+		t.Fatal(err)
+	}
+	out := captureOutput(t, func() {
+		status, err = executeCheck(nil)
+	})
+	if err != nil || status != sensu.CheckStateCritical {
+		t.Fatalf("expected critical without a change, got %d (%v)", status, err)
+	}
+	if !strings.HasPrefix(out, "Metric pipeline_processed_total is stuck at 42.000000 for 1h0m") {
+		t.Errorf("unexpected output %q", out)
+	}
+	state, err := loadState(plugin.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state["pipeline_processed_total"].Changed != stuckSince {
+		t.Errorf("expected the time of the last change to be kept, got %d", state["pipeline_processed_total"].Changed)
+	}
+}
+
+func TestExecuteCheckHosts(t *testing.T) {
+	setupPlugin(t, upMetrics)
+	host := strings.TrimPrefix(plugin.Urls[0], "http://")
+	plugin.Urls = nil
+	plugin.Hosts = []string{host}
+	plugin.Scheme, plugin.Path = "http", "/metrics"
+	plugin.Metrics = []string{"up"}
+	plugin.Max = 1
+
+	if _, err := checkArgs(nil); err != nil {
+		t.Fatal(err)
+	}
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateOK {
+		t.Fatalf("expected the URL to be built from --hosts, got %d (%v)", status, err)
+	}
+
+	plugin.Urls, plugin.Hosts = []string{defaultURL}, []string{host}
+	if _, err := checkArgs(nil); err != nil || len(plugin.Hosts) != 0 {
+		t.Fatalf("expected --url to take precedence over --hosts, got %v (%v)", plugin.Hosts, err)
+	}
+	status, err = executeCheck(nil)
+	if err != nil || status == sensu.CheckStateOK {
+		t.Errorf("expected the explicit --url to be scraped instead of --hosts, even if it is the default one, got %d (%v)", status, err)
+	}
+}
+
+func TestExecuteCheckDnsSdName(t *testing.T) {
+	setupPlugin(t, "")
+	t.Cleanup(func() { lookupSRV = net.LookupSRV })
+	var mu sync.Mutex
+	scraped := map[string]int{}
+	var records []*net.SRV
+	for i := 0; i < 3; i++ {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			scraped[r.Host]++
+			mu.Unlock()
+			fmt.Fprint(w, "up 1\n")
+		}))
+		t.Cleanup(server.Close)
+		host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+		number, _ := strconv.Atoi(port)
+		records = append(records, &net.SRV{Target: host + ".", Port: uint16(number), Priority: uint16(i), Weight: 10})
+	}
+	lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		if name != "_metrics._tcp.example.com" {
+			return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+		}
+		return "", records, nil
+	}
+	plugin.Urls = nil
+	plugin.DnsSdName = "_metrics._tcp.example.com"
+	plugin.Scheme, plugin.Path = "http", "/metrics"
+	plugin.Metrics = []string{"up"}
+	plugin.Value = 1
+
+	if _, err := checkArgs(nil); err != nil {
+		t.Fatal(err)
+	}
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateOK || len(scraped) != len(records) {
+		t.Errorf("expected every target of the SRV record to be scraped, got %v, %d (%v)", scraped, status, err)
+	}
+}
+
+func TestExecuteCheckTolerance(t *testing.T) {
+	setupPlugin(t, "ratio 0.4999999\n")
+	plugin.Metrics = []string{"ratio"}
+	plugin.Value = 0.5
+
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateCritical {
+		t.Fatalf("expected an exact match to fail, got %d (%v)", status, err)
+	}
+
+	plugin.Tolerance = 0.000001
+	status, err = executeCheck(nil)
+	if err != nil || status != sensu.CheckStateOK {
+		t.Fatalf("expected the value to match within tolerance, got %d (%v)", status, err)
+	}
+}
+
+func TestExecuteCheckRequireLabels(t *testing.T) {
+	setupPlugin(t, upMetrics)
+	plugin.Metrics = []string{"up"}
+	plugin.Min = 0
+	plugin.RequireLabels = []string{"instance=a", "b", "d"}
+
+	output := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical for the missing instance, got %d (%v)", status, err)
+		}
+	})
+	if !strings.Contains(output, "has no series with instance=d") || strings.Contains(output, "instance=b\n") {
+		t.Errorf("expected only instance d to be reported, got %q", output)
+	}
+}
+
+func TestExecuteCheckFallbackUrl(t *testing.T) {
+	setupPlugin(t, upMetrics)
+	down := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(down.Close)
+	plugin.FallbackUrl = plugin.Urls[0]
+	plugin.Urls = []string{down.URL}
+	plugin.Metrics = []string{"up"}
+	plugin.Min = 0
+
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateOK {
+		t.Fatalf("expected the fallback URL to be scraped, got %d (%v)", status, err)
+	}
+
+	plugin.FallbackUrl = down.URL
+	output := captureOutput(t, func() {
+		status, err = executeCheck(nil)
+	})
+	if err != nil || status != sensu.CheckStateUnknown || strings.Count(output, "Failed:") != 2 {
+		t.Fatalf("expected unknown with both failures reported, got %d (%v): %q", status, err, output)
+	}
+}
+
+func TestExecuteCheckPerfdata(t *testing.T) {
+	setupPlugin(t, upMetrics)
+	plugin.Metrics = []string{"up"}
+	plugin.Min = 1
+	plugin.Perfdata = true
+
+	output := captureOutput(t, func() {
+		if _, err := executeCheck(nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if !strings.Contains(output, "| 'up_instance__a'=1;;1:;; 'up_instance__b'=1;;1:;; 'up_instance__c'=0;;1:;;\n") {
+		t.Errorf("expected perfdata for every series, got %q", output)
+	}
+}
+
+func TestExecuteCheckExclude(t *testing.T) {
+	setupPlugin(t, upMetrics)
+	plugin.Metrics = []string{"up"}
+	plugin.Min = 0
+	plugin.Excludes = []string{"u."}
+
+	output := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != checkStates[plugin.MissingState] {
+			t.Fatalf("expected every series to be excluded, got %d (%v)", status, err)
+		}
+	})
+	if !strings.Contains(output, "Excluded 3 series of metric up") {
+		t.Errorf("expected the excluded series to be counted, got %q", output)
+	}
+}
+
+func TestQueryMetricFamiliesUserAgent(t *testing.T) {
+	setupPlugin(t, "")
+	agents := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.UserAgent())
+	}))
+	t.Cleanup(server.Close)
+
+	for _, agent := range []string{"", "custom/1.0"} {
+		plugin.UserAgent = agent
+		if _, err := QueryMetricFamilies(server.URL, pluginCredentials(), false, "", "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(agents) != 2 || !strings.HasPrefix(agents[0], "sensu-prometheus-metrics-checks/") || agents[1] != "custom/1.0" {
+		t.Errorf("unexpected User-Agent headers %v", agents)
+	}
+}
+
+func TestExecuteCheckActiveWindow(t *testing.T) {
+	setupPlugin(t, upMetrics)
+	plugin.Metrics = []string{"up"}
+	plugin.Min = 1
+	plugin.Timezone = "UTC"
+	plugin.InactiveState = "ok"
+	now := time.Now().UTC()
+	inactive := now.Add(2 * time.Hour)
+	plugin.ActiveWindow = fmt.Sprintf("%s-%s", inactive.Format("15:04"), inactive.Add(time.Minute).Format("15:04"))
+
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateOK {
+		t.Fatalf("expected ok outside of the active window, got %d (%v)", status, err)
+	}
+
+	plugin.ActiveWindow = fmt.Sprintf("%s-%s", now.Add(-time.Hour).Format("15:04"), now.Add(time.Hour).Format("15:04"))
+	status, err = executeCheck(nil)
+	if err != nil || status != sensu.CheckStateCritical {
+		t.Fatalf("expected thresholds to be checked within the active window, got %d (%v)", status, err)
+	}
+}
+
+func TestExecuteCheckFailFast(t *testing.T) {
+	setupPlugin(t, "queue_depth{queue=\"a\"} 20\nqueue_depth{queue=\"b\"} 30\n")
+	plugin.Metrics = []string{"queue_depth"}
+	plugin.Max = 10
+	plugin.FailFast = true
+
+	output := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical, got %d (%v)", status, err)
+		}
+	})
+	if strings.Count(output, "Check require maximum") != 1 {
+		t.Errorf("expected evaluation to stop at the first breach, got %q", output)
+	}
+}
+
+func TestExecuteCheckMetricPrefix(t *testing.T) {
+	setupPlugin(t, "node_load1 1\nnode_load5 12\ngo_goroutines 30\n")
+	plugin.MetricPrefix = "node_load"
+	plugin.Max = 10
+
+	output := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical for node_load5, got %d (%v)", status, err)
+		}
+	})
+	if !strings.Contains(output, "node_load5") || strings.Contains(output, "go_goroutines") {
+		t.Errorf("expected only node_load metrics to be checked, got %q", output)
+	}
+}
+
+func TestExecuteCheckCardinalityBy(t *testing.T) {
+	setupPlugin(t, "a{job=\"node\"} 1\nb{job=\"node\"} 1\nc{job=\"app\"} 1\n")
+	plugin.CardinalityBy = "job"
+
+	output := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateOK {
+			t.Fatalf("expected ok without --count-max, got %d (%v)", status, err)
+		}
+	})
+	if output != "job=node has 2 series\njob=app has 1 series\n" {
+		t.Errorf("unexpected breakdown %q", output)
+	}
+}
+
+func TestQueryMetricFamiliesServerName(t *testing.T) {
+	setupPlugin(t, "")
+	serverName := ""
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverName = r.TLS.ServerName
+	}))
+	t.Cleanup(server.Close)
+
+	plugin.ServerName = "metrics.example.com"
+	if _, err := QueryMetricFamilies(server.URL, pluginCredentials(), true, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if serverName != "metrics.example.com" {
+		t.Errorf("expected SNI metrics.example.com, got %q", serverName)
+	}
+}
+
+func TestQueryMetricFamiliesTLSMinVersion(t *testing.T) {
+	setupPlugin(t, "")
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	plugin.TLSMinVersion = "1.2"
+	if _, err := QueryMetricFamilies(server.URL, pluginCredentials(), true, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	plugin.TLSMinVersion = "1.3"
+	if _, err := QueryMetricFamilies(server.URL, pluginCredentials(), true, "", "", ""); err == nil {
+		t.Errorf("expected the handshake to fail below TLS 1.3")
+	}
+}
+
+func TestQueryMetricFamiliesCaCert(t *testing.T) {
+	setupPlugin(t, "")
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+	cacert := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(cacert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := QueryMetricFamilies(server.URL, pluginCredentials(), false, "", "", cacert); err != nil {
+		t.Errorf("expected a CA without a client certificate to be enough, got %v", err)
+	}
+	if _, err := QueryMetricFamilies(server.URL, pluginCredentials(), false, "", "", ""); err == nil {
+		t.Errorf("expected the certificate of the exporter to be rejected without its CA")
+	}
+}
+
+func TestExecuteCheckBaselineFile(t *testing.T) {
+	setupPlugin(t, "requests{job=\"a\"} 95\nrequests{job=\"b\"} 70\nrequests{job=\"c\"} 1\n")
+	plugin.Metrics = []string{"requests"}
+	plugin.BaselineFile = filepath.Join(t.TempDir(), "baseline.prom")
+	plugin.DeviationPercent = 10
+	plugin.NoBaselineState = "warning"
+	if err := os.WriteFile(plugin.BaselineFile, []byte("requests{job=\"a\"} 100\nrequests{job=\"b\"} 50\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical for job b, got %d (%v)", status, err)
+		}
+	})
+	if strings.Contains(output, `job="a"`) || !strings.Contains(output, `requests{job="b"} is at 70.000000, 40.0% from its baseline`) || !strings.Contains(output, `requests{job="c"} has no baseline`) {
+		t.Errorf("unexpected output %q", output)
+	}
+}
+
+func TestExecuteCheckWarnThresholds(t *testing.T) {
+	setupPlugin(t, "queue_depth 15\n")
+	plugin.Metrics = []string{"queue_depth"}
+	plugin.WarnMax = 10
+	plugin.Max = 20
+
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateWarning {
+		t.Fatalf("expected warning above --warn-max, got %d (%v)", status, err)
+	}
+
+	plugin.Max = 12
+	output := captureOutput(t, func() {
+		status, err = executeCheck(nil)
+	})
+	if err != nil || status != sensu.CheckStateCritical || strings.Contains(output, "warn maximum") {
+		t.Fatalf("expected only critical above --max, got %d (%v): %q", status, err, output)
+	}
+}
+
+func TestExecuteCheckRanges(t *testing.T) {
+	setupPlugin(t, "temperature 25\n")
+	plugin.Metrics = []string{"temperature"}
+	plugin.Warning = "@20:30"
+	plugin.Critical = "~:40"
+
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateWarning {
+		t.Fatalf("expected warning inside of the warning range, got %d (%v)", status, err)
+	}
+
+	plugin.Critical = "10:20"
+	status, err = executeCheck(nil)
+	if err != nil || status != sensu.CheckStateCritical {
+		t.Fatalf("expected critical outside of the critical range, got %d (%v)", status, err)
+	}
+}
+
+func TestExecuteCheckCondition(t *testing.T) {
+	setupPlugin(t, upMetrics)
+	plugin.Metrics = []string{"up"}
+	plugin.Condition = "value == 1 || value == 2"
+
+	output := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical for the series that is down, got %d (%v)", status, err)
+		}
+	})
+	if !strings.Contains(output, `Metric up{instance="c"} is at 0.000000. Check require condition value == 1 || value == 2`) {
+		t.Errorf("unexpected output %q", output)
+	}
+}
+
+func TestExecuteCheckMetricRegex(t *testing.T) {
+	setupPlugin(t, "node_filesystem_avail_bytes 10\nnode_filesystem_free_bytes 200\nnode_filesystem_size_bytes 1\n")
+	plugin.Metrics = []string{"node_filesystem_(avail|free)_bytes"}
+	plugin.MetricRegex = true
+	plugin.Min = 100
+
+	output := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical for the available bytes, got %d (%v)", status, err)
+		}
+	})
+	if !strings.Contains(output, "Metric node_filesystem_avail_bytes is at 10.000000") || strings.Contains(output, "size_bytes") {
+		t.Errorf("expected the concrete metric name in the output, got %q", output)
+	}
+}
+
+func TestExecuteCheckMultipleMetrics(t *testing.T) {
+	setupPlugin(t, "node_load1 1\nnode_load5 12\nnode_load15 3\n")
+	plugin.Metrics = []string{"node_load1", "node_load5", "node_load30"}
+	plugin.Max = 10
+	plugin.MissingState = "warning"
+
+	output := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical for node_load5, got %d (%v)", status, err)
+		}
+	})
+	if !strings.Contains(output, "Metric node_load5 is at 12.000000") || !strings.Contains(output, "Metric node_load30 not found") || strings.Contains(output, "node_load15") {
+		t.Errorf("expected every metric to be reported individually, got %q", output)
+	}
+}
+
+func TestExecuteCheckSeriesCount(t *testing.T) {
+	setupPlugin(t, upMetrics)
+	plugin.Metrics = []string{"up"}
+	plugin.MinCount = 4
+
+	output := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical below --min-count, got %d (%v)", status, err)
+		}
+	})
+	if !strings.Contains(output, "Metric up has 3 series. Check require at least 4") {
+		t.Errorf("unexpected output %q", output)
+	}
+
+	plugin.MinCount, plugin.MaxCount = 3, 3
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateOK {
+		t.Fatalf("expected ok with the expected number of series, got %d (%v)", status, err)
+	}
+}
+
+func TestExecuteCheckAbsent(t *testing.T) {
+	setupPlugin(t, upMetrics)
+	plugin.Metrics = []string{"up"}
+	plugin.Labels = []string{"instance:c"}
+	plugin.Absent = true
+
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateOK {
+		t.Fatalf("expected ok for a present metric whatever its value, got %d (%v)", status, err)
+	}
+
+	plugin.Labels = []string{"instance:d"}
+	status, err = executeCheck(nil)
+	if err != nil || status != sensu.CheckStateCritical {
+		t.Fatalf("expected critical for an absent metric, got %d (%v)", status, err)
+	}
+}
+
+func TestExecuteCheckOnMissing(t *testing.T) {
+	setupPlugin(t, upMetrics)
+	plugin.Metrics = []string{"missing"}
+	plugin.Max = 1
+	plugin.MissingState, plugin.OnMissing = "ok", "critical"
+
+	if _, err := checkArgs(nil); err != nil {
+		t.Fatal(err)
+	}
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateCritical {
+		t.Fatalf("expected --on-missing to take precedence, got %d (%v)", status, err)
+	}
+}
+
+func TestExecuteCheckMaxOutputLines(t *testing.T) {
+	setupPlugin(t, upMetrics)
+	plugin.Metrics = []string{"up"}
+	plugin.Min = 2
+	plugin.MaxFailures, plugin.MaxOutputLines = 20, 1
+
+	if _, err := checkArgs(nil); err != nil {
+		t.Fatal(err)
+	}
+	output := captureOutput(t, func() { executeCheck(nil) })
+	if strings.Count(output, "\n") != 2 || !strings.HasSuffix(output, "...and 2 more\n") {
+		t.Errorf("expected --max-output-lines to take precedence, got %q", output)
+	}
+}
+
+func TestCheckArgsExplicitURL(t *testing.T) {
+	for option, set := range map[string]func(){
+		"hosts":          func() { plugin.Hosts = []string{"node-1"} },
+		"srv":            func() { plugin.Srv = "_metrics._tcp.example.com" },
+		"urls-file":      func() { plugin.UrlsFile = "urls.txt" },
+		"targets-file":   func() { plugin.TargetsFile = "targets.json" },
+		"kube-service":   func() { plugin.KubeService, plugin.KubePort = "monitoring/node-exporter", "metrics" },
+		"consul-service": func() { plugin.ConsulService, plugin.ConsulTags = "node-exporter", []string{"prod"} },
+	} {
+		setupPlugin(t, upMetrics)
+		plugin.Metrics = []string{"up"}
+		plugin.Max = 1
+		set()
+		if _, err := checkArgs(nil); err != nil {
+			t.Fatalf("--%s: %v", option, err)
+		}
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateOK {
+			t.Errorf("expected --url to take precedence over --%s, got %d (%v)", option, status, err)
+		}
+	}
+}
+
+func TestCheckArgsDnsSdName(t *testing.T) {
+	setupPlugin(t, "")
+	plugin.Metrics = []string{"up"}
+	plugin.Value = 1
+	plugin.Urls = nil
+	plugin.Srv, plugin.DnsSdName = "_old._tcp.example.com", "_metrics._tcp.example.com"
+
+	if _, err := checkArgs(nil); err != nil || plugin.Srv != "_metrics._tcp.example.com" || !plugin.SrvAll {
+		t.Fatalf("expected --dns-sd-name to take precedence and resolve every target, got %s, %v (%v)", plugin.Srv, plugin.SrvAll, err)
+	}
+	plugin.UrlsFile = "urls.txt"
+	if _, err := checkArgs(nil); err == nil {
+		t.Error("expected --dns-sd-name to conflict with --urls-file like --srv")
+	}
+}
+
+func TestCheckArgsTLSServerName(t *testing.T) {
+	setupPlugin(t, "")
+	plugin.Metrics = []string{"up"}
+	plugin.Value = 1
+	plugin.ServerName, plugin.TLSServerName = "old.example.com", "node.example.com"
+
+	if _, err := checkArgs(nil); err != nil || plugin.ServerName != "node.example.com" {
+		t.Fatalf("expected --tls-server-name to take precedence, got %s (%v)", plugin.ServerName, err)
+	}
+	plugin.HTTPConfigFile = filepath.Join(t.TempDir(), "http.yml")
+	if err := os.WriteFile(plugin.HTTPConfigFile, []byte("tls_config:\n  server_name: other.example.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checkArgs(nil); err == nil || !strings.Contains(err.Error(), "--servername") {
+		t.Errorf("expected --tls-server-name to conflict with the HTTP config file, got %v", err)
+	}
+}
+
+func TestQueryMetricFamiliesTimeout(t *testing.T) {
+	setupPlugin(t, "")
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(done) })
+
+	plugin.Timeout = 1
+	start := time.Now()
+	_, err := QueryMetricFamilies(server.URL, pluginCredentials(), false, "", "", "")
+	if err == nil || !strings.Contains(err.Error(), "timed out after 1s") {
+		t.Fatalf("expected the scrape to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the scrape to give up after the timeout, took %s", elapsed)
+	}
+}
+
+func TestQueryMetricFamiliesConnectTimeout(t *testing.T) {
+	setupPlugin(t, "")
+	plugin.ConnectTimeout = 1
+
+	// 10.255.255.1 is not routed, connecting to it hangs until the timeout.
+	_, err := QueryMetricFamilies("http://10.255.255.1/metrics", pluginCredentials(), false, "", "", "")
+	if err == nil || !strings.Contains(err.Error(), "connecting to exporter") {
+		t.Skipf("10.255.255.1 does not blackhole connections on this network: %v", err)
+	}
+	if !strings.Contains(err.Error(), "connecting to exporter timed out after 1s") {
+		t.Errorf("expected the connection to time out after 1s, got %v", err)
+	}
+	if stage := describeError(err); stage != "connection timed out" {
+		t.Errorf("expected a connection timeout, got %q", stage)
+	}
+}
+
+func TestQueryMetricFamiliesRetries(t *testing.T) {
+	setupPlugin(t, "")
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, upMetrics)
+	}))
+	t.Cleanup(server.Close)
+
+	plugin.Retries, plugin.RetryDelay = 1, "1ms"
+	if _, err := QueryMetricFamilies(server.URL, pluginCredentials(), false, "", "", ""); err == nil {
+		t.Fatal("expected the scrape to fail after a single retry")
+	}
+	attempts = 0
+	plugin.Retries = 2
+	families, err := QueryMetricFamilies(server.URL, pluginCredentials(), false, "", "", "")
+	if err != nil || families["up"] == nil {
+		t.Fatalf("expected the scrape to succeed on the last retry, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{&StatusError{StatusCode: http.StatusBadGateway}, true},
+		{&StatusError{StatusCode: http.StatusNotFound}, false},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host"}}, false},
+		{io.ErrUnexpectedEOF, true},
+		{errors.New("tls: bad certificate"), false},
+	} {
+		if got := retryable(tc.err); got != tc.want {
+			t.Errorf("retryable(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestQueryMetricFamiliesProxyUrl(t *testing.T) {
+	setupPlugin(t, "")
+	hosts := []string{}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host)
+		fmt.Fprint(w, upMetrics)
+	}))
+	t.Cleanup(proxy.Close)
+
+	plugin.ProxyUrl = proxy.URL
+	families, err := QueryMetricFamilies("http://exporter.invalid:9100/metrics", pluginCredentials(), false, "", "", "")
+	if err != nil || families["up"] == nil {
+		t.Fatalf("expected the scrape to go through the proxy, got %v", err)
+	}
+	if len(hosts) != 1 || hosts[0] != "exporter.invalid:9100" {
+		t.Errorf("unexpected proxied hosts %v", hosts)
+	}
+
+	plugin.ProxyUrl = "proxy:3128"
+	if _, err := proxyURL(); err == nil || !strings.Contains(err.Error(), "--proxy-url") {
+		t.Errorf("expected an invalid --proxy-url to be rejected, got %v", err)
+	}
+}
+
+func TestQueryMetricFamiliesHeaders(t *testing.T) {
+	setupPlugin(t, "")
+	var received *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+	}))
+	t.Cleanup(server.Close)
+
+	plugin.Headers = []string{"X-Scope-OrgID: tenant-a", "X-Trace: 1", "X-Trace: 2", "Host: exporter.example.com"}
+	if _, err := QueryMetricFamilies(server.URL, pluginCredentials(), false, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if received.Header.Get("X-Scope-OrgID") != "tenant-a" || strings.Join(received.Header.Values("X-Trace"), ",") != "1,2" || received.Host != "exporter.example.com" {
+		t.Errorf("unexpected headers %v for host %s", received.Header, received.Host)
+	}
+
+	for _, header := range []string{"X-Trace", ": value", "X Trace: 1"} {
+		if _, err := parseHeaders([]string{header}); err == nil {
+			t.Errorf("expected --header %q to be rejected", header)
+		}
+	}
+}
+
+func TestQueryMetricFamiliesBearerToken(t *testing.T) {
+	setupPlugin(t, "")
+	authorization := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	t.Cleanup(server.Close)
+
+	plugin.BearerToken = "s3cr3t"
+	if _, err := QueryMetricFamilies(server.URL, pluginCredentials(), false, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "Bearer s3cr3t" {
+		t.Errorf("expected a bearer token, got %q", authorization)
+	}
+
+	plugin.Metrics, plugin.Max, plugin.User = []string{"up"}, 1, "sensu"
+	if _, err := checkArgs(nil); err == nil || !strings.Contains(err.Error(), "--bearer-token") {
+		t.Errorf("expected --bearer-token to be rejected with basic auth, got %v", err)
+	}
+}
+
+func TestQueryMetricFamiliesBearerTokenFile(t *testing.T) {
+	setupPlugin(t, "")
+	authorizations := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+	}))
+	t.Cleanup(server.Close)
+
+	plugin.BearerTokenFile = filepath.Join(t.TempDir(), "token")
+	for _, token := range []string{"first", "rotated"} {
+		if err := os.WriteFile(plugin.BearerTokenFile, []byte(token+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := QueryMetricFamilies(server.URL, pluginCredentials(), false, "", "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strings.Join(authorizations, ",") != "Bearer first,Bearer rotated" {
+		t.Errorf("expected the rotated token to be picked up, got %v", authorizations)
+	}
+}
+
+func TestQueryMetricFamiliesGzip(t *testing.T) {
+	setupPlugin(t, "")
+	encodings := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings = append(encodings, r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Content-Encoding", "gzip")
+		writer := gzip.NewWriter(w)
+		fmt.Fprint(writer, upMetrics)
+		writer.Close()
+	}))
+	t.Cleanup(server.Close)
+
+	for _, headers := range [][]string{nil, {"Accept-Encoding: gzip, identity"}} {
+		plugin.Headers = headers
+		families, err := QueryMetricFamilies(server.URL, pluginCredentials(), false, "", "", "")
+		if err != nil || len(families["up"].GetMetric()) != 3 {
+			t.Fatalf("expected the gzip response to be decompressed, got %v (%v)", families, err)
+		}
+	}
+	if strings.Join(encodings, ",") != "gzip,gzip, identity" {
+		t.Errorf("unexpected Accept-Encoding headers %v", encodings)
+	}
+}
+
+func TestQueryMetricFamiliesMethodBody(t *testing.T) {
+	setupPlugin(t, "")
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.Header.Get("Content-Type")+" "+string(body))
+		fmt.Fprint(w, upMetrics)
+	}))
+	t.Cleanup(server.Close)
+
+	for _, tc := range []struct {
+		method, body string
+		headers      []string
+	}{
+		{"GET", "", nil},
+		{"POST", "collect[]=cpu", nil},
+		{"POST", `{"collect":["cpu"]}`, nil},
+		{"POST", "cpu", []string{"Content-Type: text/plain"}},
+	} {
+		plugin.Method, plugin.Body, plugin.Headers = tc.method, tc.body, tc.headers
+		if _, err := QueryMetricFamilies(server.URL, pluginCredentials(), false, "", "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"GET  ",
+		"POST application/x-www-form-urlencoded collect[]=cpu",
+		`POST application/json {"collect":["cpu"]}`,
+		"POST text/plain cpu",
+	}
+	if strings.Join(requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected requests %q", requests)
+	}
+}
+
+func TestAddParams(t *testing.T) {
+	for _, tc := range []struct {
+		target string
+		params []string
+		want   string
+	}{
+		{"http://localhost:9100/metrics", nil, "http://localhost:9100/metrics"},
+		{"http://localhost:9100/metrics", []string{"collect[]=cpu", "collect[]=meminfo"}, "http://localhost:9100/metrics?collect%5B%5D=cpu&collect%5B%5D=meminfo"},
+		{"http://localhost:9182/metrics?format=text", []string{"collect[]=cpu,cs"}, "http://localhost:9182/metrics?format=text&collect%5B%5D=cpu%2Ccs"},
+	} {
+		got, err := addParams(tc.target, tc.params)
+		if err != nil || got != tc.want {
+			t.Errorf("addParams(%s, %v) = %s (%v), want %s", tc.target, tc.params, got, err, tc.want)
+		}
+	}
+	if _, err := addParams(defaultURL, []string{"collect[]"}); err == nil {
+		t.Error("expected a parameter without value to be an error")
+	}
+}
+
+func TestExecuteCheckMultipleUrls(t *testing.T) {
+	setupPlugin(t, "up 1\n")
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "up 0\n")
+	}))
+	t.Cleanup(down.Close)
+	plugin.Urls = append(plugin.Urls, down.URL)
+	plugin.Metrics = []string{"up"}
+	plugin.Value = 1
+
+	output := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical for the down target, got %d (%v)", status, err)
+		}
+	})
+	if !strings.Contains(output, `instance="`+strings.TrimPrefix(down.URL, "http://")+`"`) || strings.Contains(output, strings.TrimPrefix(plugin.Urls[0], "http://")) {
+		t.Errorf("expected only the series of the down target to fail, got %q", output)
+	}
+
+	plugin.FallbackUrl = down.URL
+	if _, err := checkArgs(nil); err == nil {
+		t.Error("expected --fallback-url to require a single --url")
+	}
+}
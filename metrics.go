@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// metricFormats lists the formats accepted by --output-metric-format.
+var metricFormats = []string{"prometheus_text", "graphite_plaintext", "influxdb_line", "opentsdb_line"}
+
+// labelValueEscaper escapes label values the way the Prometheus text format
+// requires.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// influxEscaper escapes measurements, tag keys and tag values of the InfluxDB
+// line protocol.
+var influxEscaper = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+
+// pathSanitizer replaces the characters that would break a Graphite path
+// component or an OpenTSDB tag.
+var pathSanitizer = strings.NewReplacer(".", "_", " ", "_", "=", "_", "\n", "_", "\t", "_")
+
+// metricName turns name into a valid Prometheus metric name, replacing the
+// characters metric names can't hold, such as the operators in the names of
+// --expr and --metric-numerator results, by underscores.
+func metricName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		valid := r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9')
+		if valid {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// metricPoint formats the value of a series as a metric point in the
+// --output-metric-format for Sensu output metric extraction, timestamped now
+// in the formats that require it.
+func metricPoint(metric model.Metric, value float64, now time.Time) string {
+	names := []string{}
+	for name := range metric {
+		if name != model.MetricNameLabel {
+			names = append(names, string(name))
+		}
+	}
+	sort.Strings(names)
+	name := metricName(string(metric[model.MetricNameLabel]))
+	labels := []string{}
+
+	switch plugin.OutputMetricFormat {
+	case "graphite_plaintext":
+		path := []string{name}
+		for _, label := range names {
+			path = append(path, label, pathSanitizer.Replace(string(metric[model.LabelName(label)])))
+		}
+		return fmt.Sprintf("%s %g %d", strings.Join(path, "."), value, now.Unix())
+	case "influxdb_line":
+		measurement := []string{influxEscaper.Replace(name)}
+		for _, label := range names {
+			measurement = append(measurement, influxEscaper.Replace(label)+"="+influxEscaper.Replace(string(metric[model.LabelName(label)])))
+		}
+		return fmt.Sprintf("%s value=%g %d", strings.Join(measurement, ","), value, now.UnixNano())
+	case "opentsdb_line":
+		for _, label := range names {
+			labels = append(labels, " "+label+"="+pathSanitizer.Replace(string(metric[model.LabelName(label)])))
+		}
+		return fmt.Sprintf("%s %d %g%s", name, now.Unix(), value, strings.Join(labels, ""))
+	}
+
+	for _, label := range names {
+		labels = append(labels, fmt.Sprintf(`%s="%s"`, label, labelValueEscaper.Replace(string(metric[model.LabelName(label)]))))
+	}
+	if len(labels) == 0 {
+		return fmt.Sprintf("%s %g", name, value)
+	}
+	return fmt.Sprintf("%s{%s} %g", name, strings.Join(labels, ","), value)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+func TestMetricPoint(t *testing.T) {
+	tests := []struct {
+		metric model.Metric
+		want   string
+	}{
+		{model.Metric{"__name__": "up"}, "up 1"},
+		{model.Metric{"__name__": "up", "job": "node", "instance": "a:9100"}, `up{instance="a:9100",job="node"} 1`},
+		{model.Metric{"__name__": "avail / size", "path": `C:\ "data"`}, `avail___size{path="C:\\ \"data\""} 1`},
+		{model.Metric{"__name__": "9lives"}, "_lives 1"},
+	}
+	for _, test := range tests {
+		if got := metricPoint(test.metric, 1, time.Now()); got != test.want {
+			t.Errorf("expected %s, got %s", test.want, got)
+		}
+	}
+}
+
+func TestMetricPointFormats(t *testing.T) {
+	setupPlugin(t, "")
+	metric := model.Metric{"__name__": "node_load1", "instance": "web 1:9100", "job": "node"}
+	now := time.Unix(1700000000, 0)
+	tests := map[string]string{
+		"graphite_plaintext": "node_load1.instance.web_1:9100.job.node 0.5 1700000000",
+		"influxdb_line":      `node_load1,instance=web\ 1:9100,job=node value=0.5 1700000000000000000`,
+		"opentsdb_line":      "node_load1 1700000000 0.5 instance=web_1:9100 job=node",
+	}
+	for format, want := range tests {
+		plugin.OutputMetricFormat = format
+		if got := metricPoint(metric, 0.5, now); got != want {
+			t.Errorf("%s: expected %s, got %s", format, want, got)
+		}
+	}
+}
+
+func TestExecuteCheckOutputMetrics(t *testing.T) {
+	setupPlugin(t, upMetrics)
+	plugin.Metrics = []string{"up"}
+	plugin.Min = 1
+	plugin.OutputMetrics = true
+	plugin.OutputMetricFormat = "prometheus_text"
+
+	output := captureOutput(t, func() {
+		if _, err := executeCheck(nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if !strings.HasSuffix(output, "\nup{instance=\"a\"} 1\nup{instance=\"b\"} 1\nup{instance=\"c\"} 0\n") {
+		t.Errorf("expected a metric point for every series, got %q", output)
+	}
+}
+
+func TestExecuteCheckCollect(t *testing.T) {
+	setupPlugin(t, upMetrics+"node_load1 0.5\n")
+	plugin.Collect = true
+	plugin.OutputMetricFormat = "prometheus_text"
+
+	if _, err := checkArgs(nil); err != nil {
+		t.Fatal(err)
+	}
+	output := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateOK {
+			t.Fatalf("expected OK, got %d (%v)", status, err)
+		}
+	})
+	if !strings.Contains(output, "node_load1 0.5\n") || strings.Count(output, "\n") != 4 {
+		t.Errorf("expected every series, got %q", output)
+	}
+
+	plugin.Labels = []string{"instance:c"}
+	output = captureOutput(t, func() {
+		if _, err := executeCheck(nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if output != "up{instance=\"c\"} 0\n" {
+		t.Errorf("expected the series matching --label only, got %q", output)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/common/config"
+)
+
+// oauth2Transports caches the OAuth2 round trippers created during a run, so
+// that the targets scraped with the same client share a single token.
+var oauth2Transports = struct {
+	sync.Mutex
+	transports map[string]http.RoundTripper
+}{transports: map[string]http.RoundTripper{}}
+
+// newOAuth2Transport returns the transport authenticating the requests sent
+// with next with a token for creds, reusing the round tripper, and its token,
+// of the previous targets scraped with the same client. The token endpoint is
+// reached through the proxy of the scrapes, but not with their TLS settings.
+func newOAuth2Transport(creds credentials, next http.RoundTripper) (http.RoundTripper, error) {
+	key := strings.Join(append([]string{creds.OAuth2TokenURL, creds.OAuth2ClientID, creds.OAuth2ClientSecret}, creds.OAuth2Scopes...), "\x00")
+	oauth2Transports.Lock()
+	defer oauth2Transports.Unlock()
+	if rt, ok := oauth2Transports.transports[key]; ok {
+		return &sharedTransport{shared: rt, next: next}, nil
+	}
+
+	oauth2 := &config.OAuth2{
+		ClientID: creds.OAuth2ClientID,
+		Scopes:   creds.OAuth2Scopes,
+		TokenURL: creds.OAuth2TokenURL,
+	}
+	switch {
+	case plugin.Socks5 != "":
+		proxy, err := url.Parse("socks5://" + plugin.Socks5)
+		if err != nil {
+			return nil, err
+		}
+		oauth2.ProxyURL = config.URL{URL: proxy}
+	case plugin.ProxyUrl != "":
+		proxy, err := url.Parse(plugin.ProxyUrl)
+		if err != nil {
+			return nil, err
+		}
+		oauth2.ProxyURL = config.URL{URL: proxy}
+	default:
+		oauth2.ProxyFromEnvironment = true
+	}
+	logger.Debug("fetching OAuth2 tokens", "url", creds.OAuth2TokenURL, "client_id", creds.OAuth2ClientID)
+	rt := config.NewOAuth2RoundTripper(config.NewInlineSecret(creds.OAuth2ClientSecret), oauth2, nextTransport{}, clientOptions(config.NewOAuth2RoundTripper))
+	oauth2Transports.transports[key] = rt
+	return &sharedTransport{shared: rt, next: next}, nil
+}
+
+// clientOptions returns the zero options of the HTTP clients of newRT, those
+// of a client without a secret manager. Their type is not exported, it is
+// inferred from newRT.
+func clientOptions[T any](newRT func(config.SecretReader, *config.OAuth2, http.RoundTripper, *T) http.RoundTripper) *T {
+	return new(T)
+}
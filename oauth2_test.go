@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestQueryMetricFamiliesOAuth2(t *testing.T) {
+	setupPlugin(t, "")
+	t.Cleanup(func() { oauth2Transports.transports = map[string]http.RoundTripper{} })
+	requests := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		id, secret, _ := r.BasicAuth()
+		if r.Method != "POST" || r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "metrics read" || id != "sensu" || secret != "s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid_client"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":3600}`, requests)
+	}))
+	t.Cleanup(tokenServer.Close)
+	authorizations := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+	}))
+	t.Cleanup(server.Close)
+
+	plugin.OAuth2ClientID, plugin.OAuth2ClientSecret = "sensu", "s3cr3t"
+	plugin.OAuth2TokenURL, plugin.OAuth2Scopes = tokenServer.URL, []string{"metrics", "read"}
+	for range 2 {
+		if _, err := QueryMetricFamilies(server.URL, pluginCredentials(), false, "", "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if requests != 1 || strings.Join(authorizations, ",") != "Bearer token-1,Bearer token-1" {
+		t.Errorf("expected a single cached token, got %d token requests and %v", requests, authorizations)
+	}
+
+	plugin.OAuth2ClientSecret = "wrong"
+	_, err := QueryMetricFamilies(server.URL, pluginCredentials(), false, "", "", "")
+	if err == nil || !strings.Contains(err.Error(), "invalid_client") {
+		t.Errorf("expected the token endpoint error, got %v", err)
+	}
+}
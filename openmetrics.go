@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// openMetricsType is the media type of the OpenMetrics text format.
+const openMetricsType = "application/openmetrics-text"
+
+// isOpenMetrics reports whether a response with header h is in the
+// OpenMetrics text format.
+func isOpenMetrics(h http.Header) bool {
+	mediatype, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	return err == nil && mediatype == openMetricsType
+}
+
+// openMetricsReader rewrites an OpenMetrics exposition into the Prometheus
+// text format while it is read: counters are typed under their _total name,
+// _created series, exemplars, HELP and UNIT lines are dropped, timestamps are
+// converted from seconds to milliseconds, and the types the text format
+// doesn't know are mapped onto the ones it does. An exposition that doesn't
+// end with # EOF is an error, since it was truncated.
+type openMetricsReader struct {
+	r       *bufio.Reader
+	pending []byte
+	eof     bool
+	renames map[string]string
+	created map[string]bool
+}
+
+func newOpenMetricsReader(r io.Reader) *openMetricsReader {
+	return &openMetricsReader{r: bufio.NewReader(r), renames: map[string]string{}, created: map[string]bool{}}
+}
+
+func (o *openMetricsReader) Read(p []byte) (int, error) {
+	for len(o.pending) == 0 {
+		line, err := o.r.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		if line == "" && errors.Is(err, io.EOF) {
+			if !o.eof {
+				return 0, errors.New("OpenMetrics exposition ended without # EOF")
+			}
+			return 0, io.EOF
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if o.eof {
+			return 0, errors.New("OpenMetrics exposition continues after # EOF")
+		}
+		converted, err := o.convert(line)
+		if err != nil {
+			return 0, err
+		}
+		if converted != "" {
+			o.pending = []byte(converted + "\n")
+		}
+	}
+	n := copy(p, o.pending)
+	o.pending = o.pending[n:]
+	return n, nil
+}
+
+// convert returns the text format line of an OpenMetrics line, empty when it
+// is dropped.
+func (o *openMetricsReader) convert(line string) (string, error) {
+	if line == "# EOF" {
+		o.eof = true
+		return "", nil
+	}
+	if strings.HasPrefix(line, "#") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[1] != "TYPE" {
+			return "", nil
+		}
+		name, kind := fields[2], fields[3]
+		switch kind {
+		case "counter":
+			o.created[name] = true
+			return "# TYPE " + name + "_total counter", nil
+		case "histogram", "summary":
+			o.created[name] = true
+		case "gaugehistogram":
+			o.created[name] = true
+			o.renames[name+"_gcount"] = name + "_count"
+			o.renames[name+"_gsum"] = name + "_sum"
+			kind = "histogram"
+		case "info":
+			return "# TYPE " + name + "_info gauge", nil
+		case "stateset":
+			kind = "gauge"
+		case "unknown":
+			kind = "untyped"
+		}
+		return "# TYPE " + name + " " + kind, nil
+	}
+	if strings.TrimSpace(line) == "" {
+		return "", nil
+	}
+
+	nameEnd := strings.IndexAny(line, "{ ")
+	if nameEnd < 0 {
+		return "", fmt.Errorf("invalid OpenMetrics line %q", line)
+	}
+	name := line[:nameEnd]
+	if base, ok := strings.CutSuffix(name, "_created"); ok && o.created[base] {
+		return "", nil
+	}
+	if renamed, ok := o.renames[name]; ok {
+		name = renamed
+	}
+
+	// The label set ends at the first closing brace outside of a quoted
+	// label value.
+	labelsEnd := nameEnd
+	if line[nameEnd] == '{' {
+		quoted, escaped := false, false
+		for i := nameEnd + 1; i < len(line); i++ {
+			c := line[i]
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\' && quoted:
+				escaped = true
+			case c == '"':
+				quoted = !quoted
+			case c == '}' && !quoted:
+				labelsEnd = i + 1
+			}
+			if labelsEnd > nameEnd {
+				break
+			}
+		}
+		if labelsEnd == nameEnd {
+			return "", fmt.Errorf("invalid OpenMetrics line %q", line)
+		}
+	}
+	rest, _, _ := strings.Cut(line[labelsEnd:], " # ")
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return "", fmt.Errorf("invalid OpenMetrics line %q", line)
+	}
+	sample := name + line[nameEnd:labelsEnd] + " " + fields[0]
+	if len(fields) == 2 {
+		seconds, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid OpenMetrics timestamp in %q", line)
+		}
+		sample += " " + strconv.FormatInt(int64(math.Round(seconds*1000)), 10)
+	}
+	return sample, nil
+}
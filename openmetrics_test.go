@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const openMetrics = `# HELP requests Requests served.
+# TYPE requests counter
+# UNIT requests requests
+requests_total{path="/a # b"} 10 1700000000.5 # {trace_id="abc"} 1 1700000000.1
+requests_created{path="/a # b"} 1.69e+09
+# TYPE job info
+job_info{version="1.2"} 1
+# TYPE latency gaugehistogram
+latency_bucket{le="1"} 2
+latency_bucket{le="+Inf"} 3
+latency_gcount 3
+latency_gsum 1.5
+# EOF
+`
+
+func TestOpenMetricsReader(t *testing.T) {
+	data, err := io.ReadAll(newOpenMetricsReader(strings.NewReader(openMetrics)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# TYPE requests_total counter
+requests_total{path="/a # b"} 10 1700000000500
+# TYPE job_info gauge
+job_info{version="1.2"} 1
+# TYPE latency histogram
+latency_bucket{le="1"} 2
+latency_bucket{le="+Inf"} 3
+latency_count 3
+latency_sum 1.5
+`
+	if string(data) != want {
+		t.Errorf("unexpected text format\n%s", data)
+	}
+
+	for _, exposition := range []string{"up 1\n", "up 1\n# EOF\nup 2\n"} {
+		if _, err := io.ReadAll(newOpenMetricsReader(strings.NewReader(exposition))); err == nil {
+			t.Errorf("expected %q to be rejected", exposition)
+		}
+	}
+}
+
+func TestQueryMetricFamiliesOpenMetrics(t *testing.T) {
+	setupPlugin(t, "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		fmt.Fprint(w, openMetrics)
+	}))
+	t.Cleanup(server.Close)
+
+	families, err := QueryMetricFamilies(server.URL, pluginCredentials(), false, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if families["requests_total"].GetMetric()[0].GetCounter().GetValue() != 10 || families["requests_created"] != nil || len(families["latency"].GetMetric()) != 1 {
+		t.Errorf("unexpected families %v", families)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/prometheus/common/model"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+// failure is a series that did not pass the check, with the state it causes
+// the check to return and how far it is from the threshold it breached.
+type failure struct {
+	State     int
+	Message   string
+	Magnitude float64
+}
+
+// breach returns how far value is from threshold, relative to the threshold
+// so breaches of thresholds of different scales compare. A threshold of 0
+// can't be related to, so the plain distance is used instead.
+func breach(value float64, threshold float64) float64 {
+	if threshold == 0 {
+		return math.Abs(value)
+	}
+	return math.Abs(value-threshold) / math.Abs(threshold)
+}
+
+// criticalSince reports whether any failure from index from on is critical.
+func criticalSince(failures []failure, from int) bool {
+	for _, failure := range failures[from:] {
+		if failure.State == sensu.CheckStateCritical {
+			return true
+		}
+	}
+	return false
+}
+
+// worstFailure returns the failure in the worst state, with the highest
+// magnitude among those, the first one on ties, or nothing without failures.
+func worstFailure(failures []failure) []failure {
+	if len(failures) == 0 {
+		return failures
+	}
+	worst := failures[0]
+	for _, failure := range failures[1:] {
+		if failure.State > worst.State || (failure.State == worst.State && failure.Magnitude > worst.Magnitude) {
+			worst = failure
+		}
+	}
+	return []failure{worst}
+}
+
+// sortFailures orders failures for output: by value puts the worst first,
+// critical before warning and then furthest from their threshold, by name
+// sorts them by series. Otherwise they are left in evaluation order.
+func sortFailures(failures []failure, by string) {
+	switch by {
+	case "value":
+		sort.SliceStable(failures, func(i, j int) bool {
+			if failures[i].State != failures[j].State {
+				return failures[i].State > failures[j].State
+			}
+			return failures[i].Magnitude > failures[j].Magnitude
+		})
+	case "name":
+		// Failure lines start with the series they are about.
+		sort.SliceStable(failures, func(i, j int) bool { return failures[i].Message < failures[j].Message })
+	}
+}
+
+// printFailures prints the failure lines, stopping after max of them (all of
+// them when max is 0) and summarizing how many were left out.
+func printFailures(failures []failure, max int) {
+	for _, line := range failureLines(failures, max) {
+		printLine(line)
+	}
+}
+
+// failureLines returns the lines printFailures prints.
+func failureLines(failures []failure, max int) []string {
+	lines := []string{}
+	for i, failure := range failures {
+		if max > 0 && i == max {
+			return append(lines, fmt.Sprintf("...and %d more", len(failures)-max))
+		}
+		lines = append(lines, failure.Message)
+	}
+	return lines
+}
+
+// seriesName formats metric for output, keeping only the --output-labels when
+// they are set.
+func seriesName(metric model.Metric) string {
+	if len(plugin.OutputLabels) == 0 {
+		return metric.String()
+	}
+	kept := model.Metric{model.MetricNameLabel: metric[model.MetricNameLabel]}
+	for _, label := range plugin.OutputLabels {
+		if value, ok := metric[model.LabelName(label)]; ok {
+			kept[model.LabelName(label)] = value
+		}
+	}
+	return kept.String()
+}
+
+// perfdataLabel turns a series name into a label that is safe to use in
+// Nagios performance data, which reserves quotes, = and whitespace. Label
+// braces and commas are replaced too so the label reads as a single name.
+func perfdataLabel(series string) string {
+	return strings.Trim(strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`'"=|{},`, r) || unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, series), "_")
+}
+
+// perfdataRange formats thresholds as a Nagios range, which alerts when the
+// value falls outside of min:max. Unset thresholds are left out, with ~ for
+// an unbounded minimum, and an exact value becomes a range of that single
+// value.
+func perfdataRange(min float64, max float64, value float64) string {
+	switch {
+	case value != math.Pi:
+		return fmt.Sprintf("%g:%g", value, value)
+	case min != math.Pi && max != math.Pi:
+		return fmt.Sprintf("%g:%g", min, max)
+	case max != math.Pi:
+		return fmt.Sprintf("~:%g", max)
+	case min != math.Pi:
+		return fmt.Sprintf("%g:", min)
+	}
+	return ""
+}
+
+// perfdata formats a series value as a Nagios performance data entry with
+// the warning and critical ranges of the check. The --warning and --critical
+// ranges are used as given, since they already are Nagios ranges.
+func perfdata(series string, value float64) string {
+	warning, critical := plugin.Warning, plugin.Critical
+	if warning == "" {
+		warning = perfdataRange(plugin.WarnMin, plugin.WarnMax, plugin.WarnValue)
+	}
+	if critical == "" {
+		critical = perfdataRange(plugin.Min, plugin.Max, plugin.Value)
+	}
+	return fmt.Sprintf("'%s'=%g;%s;%s;;", perfdataLabel(series), value, warning, critical)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+// captureOutput returns what f prints to stdout.
+func captureOutput(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	f()
+	os.Stdout = stdout
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestPrintFailures(t *testing.T) {
+	failures := []failure{{2, "one", 0}, {2, "two", 0}, {2, "three", 0}}
+
+	out := captureOutput(t, func() { printFailures(failures, 2) })
+	if out != "one\ntwo\n...and 1 more\n" {
+		t.Errorf("unexpected truncated output %q", out)
+	}
+
+	out = captureOutput(t, func() { printFailures(failures, 0) })
+	if strings.Count(out, "\n") != 3 || strings.Contains(out, "more") {
+		t.Errorf("unexpected full output %q", out)
+	}
+}
+
+func TestSeriesName(t *testing.T) {
+	saved := plugin.OutputLabels
+	defer func() { plugin.OutputLabels = saved }()
+	metric := model.Metric{"__name__": "up", "instance": "node1", "job": "node", "pod": "abc"}
+
+	plugin.OutputLabels = nil
+	if name := seriesName(metric); name != metric.String() {
+		t.Errorf("expected all labels by default, got %s", name)
+	}
+
+	plugin.OutputLabels = []string{"instance", "job", "missing"}
+	if name := seriesName(metric); name != `up{instance="node1", job="node"}` {
+		t.Errorf("unexpected name %s", name)
+	}
+}
+
+func TestWorstFailure(t *testing.T) {
+	failures := []failure{
+		{2, "above max", breach(120, 100)},
+		{2, "below min", breach(5, 10)},
+		{2, "not the value", breach(1.1, 1)},
+	}
+	worst := worstFailure(failures)
+	if len(worst) != 1 || worst[0].Message != "below min" {
+		t.Errorf("expected the series at half its minimum to be the worst, got %v", worst)
+	}
+	failures = append(failures, failure{1, "far above warn max", breach(1000, 100)})
+	if worst := worstFailure(failures); worst[0].Message != "below min" {
+		t.Errorf("expected a critical to be worse than a warning further from its threshold, got %v", worst)
+	}
+	if len(worstFailure(nil)) != 0 {
+		t.Errorf("expected no failure without failures")
+	}
+}
+
+func TestPerfdataLabel(t *testing.T) {
+	if got := perfdataLabel(`up{instance="a b", job="it's"}`); got != "up_instance__a_b___job__it_s" {
+		t.Errorf("unexpected perfdata label %s", got)
+	}
+}
+
+func TestPerfdataRange(t *testing.T) {
+	for _, c := range []struct {
+		min, max, value float64
+		expected        string
+	}{
+		{math.Pi, math.Pi, math.Pi, ""},
+		{math.Pi, 10, math.Pi, "~:10"},
+		{math.Pi, -5, math.Pi, "~:-5"},
+		{1, math.Pi, math.Pi, "1:"},
+		{1, 10, math.Pi, "1:10"},
+		{math.Pi, math.Pi, 1, "1:1"},
+	} {
+		if got := perfdataRange(c.min, c.max, c.value); got != c.expected {
+			t.Errorf("expected range %q, got %q", c.expected, got)
+		}
+	}
+}
+
+func TestSortFailures(t *testing.T) {
+	failures := []failure{
+		{sensu.CheckStateWarning, "Metric c", 5},
+		{sensu.CheckStateCritical, "Metric b", 1},
+		{sensu.CheckStateCritical, "Metric a", 3},
+	}
+	sortFailures(failures, "value")
+	if failures[0].Message != "Metric a" || failures[1].Message != "Metric b" || failures[2].Message != "Metric c" {
+		t.Errorf("expected critical failures first, worst first, got %v", failures)
+	}
+	failures[0], failures[2] = failures[2], failures[0]
+	sortFailures(failures, "name")
+	if failures[0].Message != "Metric a" || failures[2].Message != "Metric c" {
+		t.Errorf("expected failures sorted by series, got %v", failures)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// apiResponse is the envelope of Prometheus HTTP API responses.
+type apiResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// apiURL returns the URL of the Prometheus HTTP API endpoint at path of the
+// server at serverURL, with params as query string.
+func apiURL(serverURL string, path string, params url.Values) (string, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid Prometheus URL %s: %v", serverURL, err)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawQuery = params.Encode()
+	return u.String(), nil
+}
+
+// queryAPI queries the Prometheus HTTP API endpoint at path of serverURL and
+// returns the data of the response.
+func queryAPI(serverURL string, path string, params url.Values) (*apiResponse, error) {
+	endpoint, err := apiURL(serverURL, path, params)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug("querying Prometheus", "url", endpoint)
+	response, err := fetch(endpoint, "GET", "", "application/json", pluginCredentials(), plugin.insecureSkipVerify, plugin.Cert, plugin.Key, plugin.CaCert)
+	var statusError *StatusError
+	if errors.As(err, &statusError) {
+		// Prometheus explains why it rejected the query in the body.
+		var result apiResponse
+		if json.Unmarshal(statusError.Body, &result) == nil && result.Status == "error" {
+			return nil, fmt.Errorf("Prometheus query failed with %s: %s: %s", statusError.Status, result.ErrorType, result.Error)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var result apiResponse
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("could not parse Prometheus response: %v", err)
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("Prometheus query failed: %s: %s", result.ErrorType, result.Error)
+	}
+	return &result, nil
+}
+
+// queryInstant evaluates the PromQL query on the Prometheus server at
+// serverURL and returns the resulting vector. A scalar result is returned as
+// a single sample named after the query.
+func queryInstant(serverURL string, query string) (model.Vector, error) {
+	result, err := queryAPI(serverURL, "/api/v1/query", url.Values{"query": {query}})
+	if err != nil {
+		return nil, err
+	}
+	switch result.Data.ResultType {
+	case "vector":
+		var vector model.Vector
+		if err := json.Unmarshal(result.Data.Result, &vector); err != nil {
+			return nil, fmt.Errorf("could not parse Prometheus vector: %v", err)
+		}
+		return vector, nil
+	case "scalar":
+		var scalar model.Scalar
+		if err := json.Unmarshal(result.Data.Result, &scalar); err != nil {
+			return nil, fmt.Errorf("could not parse Prometheus scalar: %v", err)
+		}
+		return model.Vector{{Metric: model.Metric{model.MetricNameLabel: model.LabelValue(query)}, Value: scalar.Value, Timestamp: scalar.Timestamp}}, nil
+	default:
+		return nil, fmt.Errorf("Prometheus query returned a %s, expected a vector or scalar", result.Data.ResultType)
+	}
+}
+
+// rangeFunctions lists the functions accepted by --range-function to reduce
+// a series of a range query to the single value thresholds are checked
+// against.
+var rangeFunctions = []string{"last", "avg", "min", "max"}
+
+// queryRange evaluates the PromQL query over the last duration at every step
+// on the Prometheus server at serverURL, reducing every resulting series to a
+// single sample with the range function fn.
+func queryRange(serverURL string, query string, duration time.Duration, step time.Duration, fn string) (model.Vector, error) {
+	end := time.Now()
+	result, err := queryAPI(serverURL, "/api/v1/query_range", url.Values{
+		"query": {query},
+		"start": {strconv.FormatInt(end.Add(-duration).Unix(), 10)},
+		"end":   {strconv.FormatInt(end.Unix(), 10)},
+		"step":  {strconv.FormatFloat(step.Seconds(), 'f', -1, 64)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Data.ResultType != "matrix" {
+		return nil, fmt.Errorf("Prometheus range query returned a %s, expected a matrix", result.Data.ResultType)
+	}
+	var matrix model.Matrix
+	if err := json.Unmarshal(result.Data.Result, &matrix); err != nil {
+		return nil, fmt.Errorf("could not parse Prometheus matrix: %v", err)
+	}
+
+	vector := model.Vector{}
+	for _, stream := range matrix {
+		if len(stream.Values) == 0 {
+			continue
+		}
+		last := stream.Values[len(stream.Values)-1]
+		sample := &model.Sample{Metric: stream.Metric, Value: last.Value, Timestamp: last.Timestamp}
+		if fn != "last" {
+			values := []float64{}
+			for _, pair := range stream.Values {
+				values = append(values, float64(pair.Value))
+			}
+			sample.Value = model.SampleValue(aggregate(values, fn))
+		}
+		vector = append(vector, sample)
+	}
+	return vector, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+// setupPrometheus points the plugin config at a test Prometheus API that
+// answers queries on path with the JSON data, recording the queries it sees.
+func setupPrometheus(t *testing.T, path string, data string) *[]string {
+	t.Helper()
+	setupPlugin(t, "")
+	queries := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		queries = append(queries, r.URL.Query().Get("query"))
+		fmt.Fprintf(w, `{"status":"success","data":%s}`, data)
+	}))
+	t.Cleanup(server.Close)
+	plugin.Urls = []string{server.URL}
+	return &queries
+}
+
+func TestQueryInstant(t *testing.T) {
+	queries := setupPrometheus(t, "/api/v1/query", `{"resultType":"vector","result":[{"metric":{"job":"a"},"value":[1700000000,"0.5"]},{"metric":{"job":"b"},"value":[1700000000,"2"]}]}`)
+	vector, err := queryInstant(plugin.Urls[0], "rate(errors_total[5m])")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vector) != 2 || vector[1].Value != 2 || vector[1].Metric["job"] != "b" {
+		t.Errorf("unexpected vector %v", vector)
+	}
+	if len(*queries) != 1 || (*queries)[0] != "rate(errors_total[5m])" {
+		t.Errorf("unexpected queries %v", *queries)
+	}
+
+	setupPrometheus(t, "/api/v1/query", `{"resultType":"scalar","result":[1700000000,"42"]}`)
+	vector, err = queryInstant(plugin.Urls[0], "scalar(up)")
+	if err != nil || len(vector) != 1 || vector[0].Value != 42 {
+		t.Errorf("expected the scalar as a single sample, got %v (%v)", vector, err)
+	}
+}
+
+func TestQueryInstantError(t *testing.T) {
+	setupPlugin(t, "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"invalid parameter \"query\": 1:6: parse error: unclosed left parenthesis"}`)
+	}))
+	t.Cleanup(server.Close)
+
+	_, err := queryInstant(server.URL, "rate(")
+	if err == nil || err.Error() != `Prometheus query failed with 400 Bad Request: bad_data: invalid parameter "query": 1:6: parse error: unclosed left parenthesis` {
+		t.Errorf("expected the error of Prometheus, got %v", err)
+	}
+}
+
+func TestExecuteCheckQuery(t *testing.T) {
+	setupPrometheus(t, "/api/v1/query", `{"resultType":"vector","result":[{"metric":{"job":"a"},"value":[1700000000,"0.5"]},{"metric":{"job":"b"},"value":[1700000000,"2"]}]}`)
+	plugin.Query = "rate(errors_total[5m])"
+	plugin.Max = 1
+
+	output := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical for job b, got %d (%v)", status, err)
+		}
+	})
+	if output != "Metric {job=\"b\"} is at 2.000000. Check require maximum 1.000000\n" {
+		t.Errorf("unexpected output %q", output)
+	}
+}
+
+const rangeMatrix = `{"resultType":"matrix","result":[{"metric":{"job":"a"},"values":[[1700000000,"1"],[1700000060,"4"],[1700000120,"1"]]},{"metric":{"job":"b"},"values":[]}]}`
+
+func TestQueryRange(t *testing.T) {
+	tests := map[string]float64{"last": 1, "avg": 2, "min": 1, "max": 4}
+	for fn, want := range tests {
+		setupPrometheus(t, "/api/v1/query_range", rangeMatrix)
+		vector, err := queryRange(plugin.Urls[0], "errors", time.Hour, time.Minute, fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vector) != 1 || float64(vector[0].Value) != want {
+			t.Errorf("%s: expected %v, got %v", fn, want, vector)
+		}
+	}
+
+	setupPrometheus(t, "/api/v1/query_range", `{"resultType":"vector","result":[]}`)
+	if _, err := queryRange(plugin.Urls[0], "errors", time.Hour, time.Minute, "last"); err == nil {
+		t.Error("expected an error for a non-matrix result")
+	}
+}
+
+func TestExecuteCheckRangeQuery(t *testing.T) {
+	setupPrometheus(t, "/api/v1/query_range", rangeMatrix)
+	plugin.Query = "errors"
+	plugin.RangeDuration = "1h"
+	plugin.RangeStep = "1m"
+	plugin.RangeFunction = "max"
+	plugin.Max = 3
+
+	output := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical for the window maximum, got %d (%v)", status, err)
+		}
+	})
+	if !strings.Contains(output, `job="a"`) {
+		t.Errorf("expected job a in output, got %q", output)
+	}
+}
+
+func TestCheckArgsRangeQuery(t *testing.T) {
+	setupPlugin(t, "")
+	plugin.Query = "errors"
+	plugin.RangeStep = "1m"
+	for _, duration := range []string{"soon", "0s"} {
+		plugin.RangeDuration = duration
+		if _, err := checkArgs(nil); err == nil {
+			t.Errorf("expected an error for --range-duration %s", duration)
+		}
+	}
+	plugin.RangeDuration = "1h"
+	plugin.RangeStep = "often"
+	if _, err := checkArgs(nil); err == nil {
+		t.Error("expected an error for an invalid --range-step")
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+// bucket is a cumulative histogram bucket.
+type bucket struct {
+	UpperBound float64
+	Count      float64
+}
+
+// selectQuantile replaces the series of metric in samples by the series of its
+// q quantile. For a summary these are the series with a matching quantile
+// label, for a histogram the quantile is estimated from the _bucket series of
+// every label set. Other metrics are left untouched.
+func selectQuantile(samples model.Vector, families map[string]*dto.MetricFamily, metric string, q float64) (model.Vector, error) {
+	family, ok := families[metric]
+	if !ok {
+		return samples, nil
+	}
+	switch family.GetType() {
+	case dto.MetricType_SUMMARY:
+		return summaryQuantile(samples, metric, q), nil
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		return histogramQuantile(samples, metric, q), nil
+	default:
+		return nil, fmt.Errorf("metric %s is a %s and has no quantile dimension", metric, family.GetType())
+	}
+}
+
+// summaryQuantile drops the series of the summary metric other than the ones
+// of the q quantile.
+func summaryQuantile(samples model.Vector, metric string, q float64) model.Vector {
+	selected := model.Vector{}
+	for _, sample := range samples {
+		if sample.Metric[model.MetricNameLabel] == model.LabelValue(metric) {
+			quantile, err := strconv.ParseFloat(string(sample.Metric[model.QuantileLabel]), 64)
+			if err != nil || quantile != q {
+				continue
+			}
+		}
+		selected = append(selected, sample)
+	}
+	return selected
+}
+
+// histogramQuantile replaces the _bucket series of the histogram metric by one
+// series per label set holding the estimated q quantile, labelled with the
+// quantile like a summary.
+func histogramQuantile(samples model.Vector, metric string, q float64) model.Vector {
+	bucketName := model.LabelValue(metric + "_bucket")
+	series := map[model.Fingerprint]*model.Sample{}
+	buckets := map[model.Fingerprint][]bucket{}
+	selected := model.Vector{}
+
+	for _, sample := range samples {
+		if sample.Metric[model.MetricNameLabel] != bucketName {
+			selected = append(selected, sample)
+			continue
+		}
+		upperBound, err := strconv.ParseFloat(string(sample.Metric[model.BucketLabel]), 64)
+		if err != nil {
+			continue
+		}
+		labels := sample.Metric.Clone()
+		delete(labels, model.BucketLabel)
+		labels[model.MetricNameLabel] = model.LabelValue(metric)
+		labels[model.QuantileLabel] = model.LabelValue(strconv.FormatFloat(q, 'f', -1, 64))
+		fingerprint := labels.Fingerprint()
+		if _, ok := series[fingerprint]; !ok {
+			series[fingerprint] = &model.Sample{Metric: labels, Timestamp: sample.Timestamp}
+			selected = append(selected, series[fingerprint])
+		}
+		buckets[fingerprint] = append(buckets[fingerprint], bucket{UpperBound: upperBound, Count: float64(sample.Value)})
+	}
+	for fingerprint, sample := range series {
+		sample.Value = model.SampleValue(bucketQuantile(q, buckets[fingerprint]))
+	}
+	return selected
+}
+
+// bucketQuantile estimates the q quantile from cumulative buckets by linear
+// interpolation within the bucket the quantile falls in, the same way as
+// PromQL's histogram_quantile. It returns NaN when the buckets hold no
+// observations or lack the +Inf bucket.
+func bucketQuantile(q float64, buckets []bucket) float64 {
+	if q < 0 {
+		return math.Inf(-1)
+	}
+	if q > 1 {
+		return math.Inf(1)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].UpperBound < buckets[j].UpperBound })
+	if len(buckets) < 2 || !math.IsInf(buckets[len(buckets)-1].UpperBound, 1) {
+		return math.NaN()
+	}
+	// Buckets are cumulative, make sure rounding errors don't break that.
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i].Count < buckets[i-1].Count {
+			buckets[i].Count = buckets[i-1].Count
+		}
+	}
+	observations := buckets[len(buckets)-1].Count
+	if observations == 0 {
+		return math.NaN()
+	}
+
+	rank := q * observations
+	b := sort.Search(len(buckets)-1, func(i int) bool { return buckets[i].Count >= rank })
+	if b == len(buckets)-1 {
+		return buckets[len(buckets)-2].UpperBound
+	}
+	if b == 0 && buckets[0].UpperBound <= 0 {
+		return buckets[0].UpperBound
+	}
+
+	lowerBound, lowerCount := 0.0, 0.0
+	if b > 0 {
+		lowerBound, lowerCount = buckets[b-1].UpperBound, buckets[b-1].Count
+	}
+	upperBound, count := buckets[b].UpperBound, buckets[b].Count-lowerCount
+	return lowerBound + (upperBound-lowerBound)*((rank-lowerCount)/count)
+}
+
+// bucketFraction replaces the _bucket and _count series of the histogram
+// metric by one series per label set holding the fraction of observations in
+// the bucket with upper bound le, labelled with that bound.
+func bucketFraction(samples model.Vector, metric string, le float64) model.Vector {
+	bucketName := model.LabelValue(metric + "_bucket")
+	countName := model.LabelValue(metric + "_count")
+	counts := map[model.Fingerprint]float64{}
+	for _, sample := range samples {
+		if sample.Metric[model.MetricNameLabel] == countName {
+			labels := sample.Metric.Clone()
+			labels[model.MetricNameLabel] = model.LabelValue(metric)
+			counts[labels.Fingerprint()] = float64(sample.Value)
+		}
+	}
+
+	selected := model.Vector{}
+	for _, sample := range samples {
+		name := sample.Metric[model.MetricNameLabel]
+		if name == countName {
+			continue
+		}
+		if name != bucketName {
+			selected = append(selected, sample)
+			continue
+		}
+		upperBound, err := strconv.ParseFloat(string(sample.Metric[model.BucketLabel]), 64)
+		if err != nil || upperBound != le {
+			continue
+		}
+		labels := sample.Metric.Clone()
+		delete(labels, model.BucketLabel)
+		labels[model.MetricNameLabel] = model.LabelValue(metric)
+		count, ok := counts[labels.Fingerprint()]
+		if !ok {
+			continue
+		}
+		labels[model.BucketLabel] = model.LabelValue(strconv.FormatFloat(le, 'f', -1, 64))
+		// No observations yields NaN, which --nan-state handles.
+		selected = append(selected, &model.Sample{Metric: labels, Value: model.SampleValue(float64(sample.Value) / count), Timestamp: sample.Timestamp})
+	}
+	return selected
+}
+
+// nativeBuckets returns the _bucket series, but the +Inf one, of the native
+// histogram of metric in the family called name, so that quantiles and
+// --bucket-le work as for classic histograms. It returns none when the
+// histogram has classic buckets or isn't native.
+func nativeBuckets(name string, metric *dto.Metric, timestamp model.Time) model.Vector {
+	h := metric.GetHistogram()
+	if h == nil || len(h.GetBucket()) > 0 || (len(h.GetPositiveSpan()) == 0 && len(h.GetNegativeSpan()) == 0 && h.ZeroThreshold == nil) {
+		return nil
+	}
+	// Schemas below -4 are custom bucket layouts, not exponential ones.
+	if h.GetSchema() < -4 || h.GetSchema() > 8 {
+		return nil
+	}
+	base := math.Pow(2, math.Pow(2, -float64(h.GetSchema())))
+	if metric.TimestampMs != nil {
+		timestamp = model.Time(metric.GetTimestampMs())
+	}
+
+	labels := model.Metric{model.MetricNameLabel: model.LabelValue(name + "_bucket")}
+	for _, pair := range metric.GetLabel() {
+		labels[model.LabelName(pair.GetName())] = model.LabelValue(pair.GetValue())
+	}
+	samples := model.Vector{}
+	cumulative := 0.0
+	add := func(upperBound float64, count float64) {
+		cumulative += count
+		bucketLabels := labels.Clone()
+		bucketLabels[model.BucketLabel] = model.LabelValue(strconv.FormatFloat(upperBound, 'g', -1, 64))
+		samples = append(samples, &model.Sample{Metric: bucketLabels, Value: model.SampleValue(cumulative), Timestamp: timestamp})
+	}
+
+	// Negative bucket i holds the values in [-base^i, -base^(i-1)), the most
+	// negative ones come first.
+	negative := nativeCounts(h.GetNegativeSpan(), h.GetNegativeDelta(), h.GetNegativeCount())
+	for i := len(negative) - 1; i >= 0; i-- {
+		add(-math.Pow(base, float64(negative[i].index-1)), negative[i].count)
+	}
+	zeroCount := float64(h.GetZeroCount())
+	if h.ZeroCountFloat != nil {
+		zeroCount = h.GetZeroCountFloat()
+	}
+	add(h.GetZeroThreshold(), zeroCount)
+	for _, b := range nativeCounts(h.GetPositiveSpan(), h.GetPositiveDelta(), h.GetPositiveCount()) {
+		add(math.Pow(base, float64(b.index)), b.count)
+	}
+	return samples
+}
+
+// nativeBucket is the count of the native histogram bucket of index.
+type nativeBucket struct {
+	index int32
+	count float64
+}
+
+// nativeCounts returns the non cumulative counts of the buckets of a native
+// histogram, in the order of their indexes, from the spans and either the
+// deltas of an integer histogram or the counts of a float histogram.
+func nativeCounts(spans []*dto.BucketSpan, deltas []int64, counts []float64) []nativeBucket {
+	buckets := []nativeBucket{}
+	index, position := int32(0), 0
+	count := int64(0)
+	for _, span := range spans {
+		index += span.GetOffset()
+		for j := uint32(0); j < span.GetLength(); j++ {
+			b := nativeBucket{index: index}
+			if len(counts) > 0 {
+				if position < len(counts) {
+					b.count = counts[position]
+				}
+			} else if position < len(deltas) {
+				count += deltas[position]
+				b.count = float64(count)
+			}
+			buckets = append(buckets, b)
+			index++
+			position++
+		}
+	}
+	return buckets
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+	"google.golang.org/protobuf/proto"
+)
+
+const quantileMetrics = `# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{quantile="0.5"} 0.05
+rpc_duration_seconds{quantile="0.99"} 0.8
+rpc_duration_seconds_sum 12
+rpc_duration_seconds_count 100
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{handler="a",le="0.1"} 50
+http_request_duration_seconds_bucket{handler="a",le="0.5"} 90
+http_request_duration_seconds_bucket{handler="a",le="1"} 100
+http_request_duration_seconds_bucket{handler="a",le="+Inf"} 100
+http_request_duration_seconds_sum{handler="a"} 20
+http_request_duration_seconds_count{handler="a"} 100
+# TYPE up gauge
+up 1
+`
+
+func TestSelectQuantile(t *testing.T) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(quantileMetrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := extractSamples(families)
+
+	summary, err := selectQuantile(samples, families, "rpc_duration_seconds", 0.99)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := 0
+	for _, sample := range summary {
+		if sample.Metric["__name__"] == "rpc_duration_seconds" {
+			found++
+			if sample.Value != 0.8 {
+				t.Errorf("expected the 0.99 quantile to be 0.8, got %f", sample.Value)
+			}
+		}
+	}
+	if found != 1 {
+		t.Errorf("expected a single summary series, got %d", found)
+	}
+
+	histogram, err := selectQuantile(samples, families, "http_request_duration_seconds", 0.95)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found = 0
+	for _, sample := range histogram {
+		if sample.Metric["__name__"] == "http_request_duration_seconds_bucket" {
+			t.Errorf("expected bucket series to be replaced, got %s", sample.Metric)
+		}
+		if sample.Metric["__name__"] == "http_request_duration_seconds" {
+			found++
+			if sample.Metric["handler"] != "a" || sample.Metric["quantile"] != "0.95" {
+				t.Errorf("unexpected labels %s", sample.Metric)
+			}
+			if math.Abs(float64(sample.Value)-0.75) > 1e-9 {
+				t.Errorf("expected the 0.95 quantile to be 0.75, got %f", sample.Value)
+			}
+		}
+	}
+	if found != 1 {
+		t.Errorf("expected a single histogram series, got %d", found)
+	}
+
+	if _, err := selectQuantile(samples, families, "up", 0.5); err == nil {
+		t.Errorf("expected an error for a gauge")
+	}
+}
+
+func TestBucketQuantile(t *testing.T) {
+	buckets := []bucket{{math.Inf(1), 10}, {1, 10}, {0.5, 5}}
+	if q := bucketQuantile(0.5, buckets); q != 0.5 {
+		t.Errorf("expected 0.5, got %f", q)
+	}
+	if q := bucketQuantile(0.5, []bucket{{1, 0}, {math.Inf(1), 0}}); !math.IsNaN(q) {
+		t.Errorf("expected NaN without observations, got %f", q)
+	}
+	if q := bucketQuantile(0.5, []bucket{{1, 3}}); !math.IsNaN(q) {
+		t.Errorf("expected NaN without a +Inf bucket, got %f", q)
+	}
+}
+
+func TestExecuteCheckHistogramQuantile(t *testing.T) {
+	setupPlugin(t, quantileMetrics)
+	plugin.Metrics = []string{"http_request_duration_seconds"}
+	plugin.Quantile = 0.95
+	plugin.Max = 0.5
+
+	out := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical for the estimated quantile, got %d (%v)", status, err)
+		}
+	})
+	if out != "Metric http_request_duration_seconds{handler=\"a\", quantile=\"0.95\"} is at 0.750000. Check require maximum 0.500000\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestExecuteCheckSummaryQuantile(t *testing.T) {
+	setupPlugin(t, "rpc_duration_seconds{quantile=\"0.5\"} 0.05\nrpc_duration_seconds{quantile=\"0.99\"} 0.8\nrpc_duration_seconds_count 100\n")
+	plugin.Metrics = []string{"rpc_duration_seconds"}
+	plugin.SummaryQuantile = 0.99
+	plugin.Max = 0.5
+
+	if _, err := checkArgs(nil); err != nil {
+		t.Fatal(err)
+	}
+	out := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical for the 0.99 quantile, got %d (%v)", status, err)
+		}
+	})
+	if out != "Metric rpc_duration_seconds{quantile=\"0.99\"} is at 0.800000. Check require maximum 0.500000\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	plugin.Quantile = 0.99
+	if _, err := checkArgs(nil); err == nil {
+		t.Error("expected an error with both --quantile and --summary-quantile")
+	}
+}
+
+func TestBucketFraction(t *testing.T) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(quantileMetrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fraction := bucketFraction(extractSamples(families), "http_request_duration_seconds", 0.5)
+	found := 0
+	for _, sample := range fraction {
+		switch sample.Metric["__name__"] {
+		case "http_request_duration_seconds_bucket", "http_request_duration_seconds_count":
+			t.Errorf("expected bucket and count series to be replaced, got %s", sample.Metric)
+		case "http_request_duration_seconds":
+			found++
+			if sample.Metric["handler"] != "a" || sample.Metric["le"] != "0.5" || sample.Value != 0.9 {
+				t.Errorf("unexpected series %s", sample)
+			}
+		}
+	}
+	if found != 1 {
+		t.Errorf("expected a single fraction series, got %d", found)
+	}
+}
+
+// nativeHistogram is a native histogram of schema 0, whose buckets double
+// in size.
+func nativeHistogram() *dto.MetricFamily {
+	return &dto.MetricFamily{
+		Name: proto.String("rpc_latency_seconds"),
+		Type: dto.MetricType_HISTOGRAM.Enum(),
+		Metric: []*dto.Metric{{
+			Label: []*dto.LabelPair{{Name: proto.String("service"), Value: proto.String("api")}},
+			Histogram: &dto.Histogram{
+				SampleCount:   proto.Uint64(7),
+				SampleSum:     proto.Float64(5),
+				Schema:        proto.Int32(0),
+				ZeroThreshold: proto.Float64(0.001),
+				ZeroCount:     proto.Uint64(1),
+				NegativeSpan:  []*dto.BucketSpan{{Offset: proto.Int32(1), Length: proto.Uint32(1)}},
+				NegativeDelta: []int64{2},
+				PositiveSpan:  []*dto.BucketSpan{{Offset: proto.Int32(0), Length: proto.Uint32(3)}},
+				PositiveDelta: []int64{1, 1, -1},
+			},
+		}},
+	}
+}
+
+func TestNativeBuckets(t *testing.T) {
+	family := nativeHistogram()
+	buckets := nativeBuckets(family.GetName(), family.GetMetric()[0], 0)
+	got := []string{}
+	for _, sample := range buckets {
+		got = append(got, fmt.Sprintf("%s=%g", sample.Metric[model.BucketLabel], float64(sample.Value)))
+	}
+	if strings.Join(got, " ") != "-1=2 0.001=3 1=4 2=6 4=7" || buckets[0].Metric["service"] != "api" {
+		t.Errorf("unexpected native buckets %v", got)
+	}
+
+	classic := &dto.Metric{Histogram: &dto.Histogram{Bucket: []*dto.Bucket{{UpperBound: proto.Float64(1), CumulativeCount: proto.Uint64(1)}}}}
+	if buckets := nativeBuckets("classic", classic, 0); len(buckets) != 0 {
+		t.Errorf("expected no native buckets for a classic histogram, got %v", buckets)
+	}
+}
+
+func TestExecuteCheckNativeHistogramQuantile(t *testing.T) {
+	setupPlugin(t, "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := expfmt.Negotiate(r.Header)
+		w.Header().Set("Content-Type", string(format))
+		if err := expfmt.NewEncoder(w, format).Encode(nativeHistogram()); err != nil {
+			t.Error(err)
+		}
+	}))
+	t.Cleanup(server.Close)
+	plugin.Urls = []string{server.URL}
+	plugin.Metrics = []string{"rpc_latency_seconds"}
+	plugin.Quantile = 0.5
+
+	for max, want := range map[float64]int{0.4: sensu.CheckStateCritical, 0.6: sensu.CheckStateOK} {
+		plugin.Max = max
+		status, err := executeCheck(nil)
+		if err != nil || status != want {
+			t.Errorf("expected %d with --max %g, got %d (%v)", want, max, status, err)
+		}
+	}
+}
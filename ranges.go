@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// thresholdRange is a Nagios threshold range. Values outside of Start to End
+// alert, or values inside of it when Inside is set.
+type thresholdRange struct {
+	Start  float64
+	End    float64
+	Inside bool
+}
+
+// parseRange parses a Nagios range as used by --critical and --warning:
+//
+//	10      alert outside of 0 to 10
+//	10:     alert below 10
+//	~:10    alert above 10
+//	10:20   alert outside of 10 to 20
+//	@10:20  alert inside of 10 to 20, inclusive
+func parseRange(spec string) (thresholdRange, error) {
+	r := thresholdRange{}
+	body, inside := strings.CutPrefix(strings.TrimSpace(spec), "@")
+	r.Inside = inside
+	start, end, bounded := strings.Cut(body, ":")
+	if !bounded {
+		start, end = "0", body
+	}
+
+	var err error
+	switch start {
+	case "~":
+		r.Start = math.Inf(-1)
+	case "":
+		if bounded {
+			return r, fmt.Errorf("invalid range '%s', start can't be empty, use ~ for no lower bound", spec)
+		}
+	default:
+		if r.Start, err = strconv.ParseFloat(start, 64); err != nil {
+			return r, fmt.Errorf("invalid range '%s', '%s' is not a number", spec, start)
+		}
+	}
+	if end == "" {
+		if !bounded {
+			return r, fmt.Errorf("invalid range '%s', expected [@][start:]end", spec)
+		}
+		r.End = math.Inf(1)
+	} else if r.End, err = strconv.ParseFloat(end, 64); err != nil {
+		return r, fmt.Errorf("invalid range '%s', '%s' is not a number", spec, end)
+	}
+	if r.Start > r.End {
+		return r, fmt.Errorf("invalid range '%s', start is greater than end", spec)
+	}
+	return r, nil
+}
+
+// parseOptionalRange parses spec like parseRange, returning nil for an unset
+// range.
+func parseOptionalRange(spec string) (*thresholdRange, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	r, err := parseRange(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// alerts reports whether value is in the alerting part of the range.
+func (r thresholdRange) alerts(value float64) bool {
+	within := value >= r.Start && value <= r.End
+	return within == r.Inside
+}
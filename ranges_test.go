@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestParseRange(t *testing.T) {
+	for _, c := range []struct {
+		spec   string
+		value  float64
+		alerts bool
+	}{
+		{"10", -1, true},
+		{"10", 0, false},
+		{"10", 10, false},
+		{"10", 11, true},
+		{"10:", 9, true},
+		{"10:", 1e9, false},
+		{"~:10", -1e9, false},
+		{"~:10", 11, true},
+		{"10:20", 15, false},
+		{"10:20", 21, true},
+		{"@10:20", 10, true},
+		{"@10:20", 21, false},
+	} {
+		r, err := parseRange(c.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.alerts(c.value); got != c.alerts {
+			t.Errorf("expected range %s to alert for %f to be %t", c.spec, c.value, c.alerts)
+		}
+	}
+	for _, spec := range []string{"", ":10", "a:10", "10:b", "20:10", "@"} {
+		if _, err := parseRange(spec); err == nil {
+			t.Errorf("expected an error for range '%s'", spec)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/prometheus/common/model"
+)
+
+// joinKey returns the labels two series of a ratio are matched on: the on
+// labels when given, otherwise all labels but the metric name.
+func joinKey(metric model.Metric, on []string) model.Fingerprint {
+	labels := model.LabelSet{}
+	if len(on) > 0 {
+		for _, name := range on {
+			if value, ok := metric[model.LabelName(name)]; ok {
+				labels[model.LabelName(name)] = value
+			}
+		}
+	} else {
+		for name, value := range metric {
+			if name != model.MetricNameLabel {
+				labels[name] = value
+			}
+		}
+	}
+	return labels.Fingerprint()
+}
+
+// ratioSamples divides every series of numerator by the series of denominator
+// with the same join labels. The ratios keep the labels of the numerator and
+// are named "numerator / denominator". Numerator series without a denominator
+// are dropped.
+func ratioSamples(samples model.Vector, numerator string, denominator string, on []string) (model.Vector, error) {
+	denominators := map[model.Fingerprint]*model.Sample{}
+	for _, sample := range samples {
+		if sample.Metric[model.MetricNameLabel] != model.LabelValue(denominator) {
+			continue
+		}
+		key := joinKey(sample.Metric, on)
+		if _, ok := denominators[key]; ok {
+			return nil, fmt.Errorf("more than one series of %s share the --ratio-on labels of %s", denominator, seriesName(sample.Metric))
+		}
+		denominators[key] = sample
+	}
+
+	name := model.LabelValue(numerator + " / " + denominator)
+	ratios := model.Vector{}
+	for _, sample := range samples {
+		if sample.Metric[model.MetricNameLabel] != model.LabelValue(numerator) {
+			continue
+		}
+		divisor, ok := denominators[joinKey(sample.Metric, on)]
+		if !ok {
+			logger.Debug("no denominator for series", "series", sample.Metric.String(), "denominator", denominator)
+			continue
+		}
+		labels := sample.Metric.Clone()
+		labels[model.MetricNameLabel] = name
+		ratios = append(ratios, &model.Sample{Metric: labels, Value: sample.Value / divisor.Value, Timestamp: sample.Timestamp})
+	}
+	return ratios, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+func TestRatioSamples(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{"__name__": "avail", "device": "sda", "fstype": "ext4"}, Value: 25},
+		{Metric: model.Metric{"__name__": "avail", "device": "sdb", "fstype": "ext4"}, Value: 10},
+		{Metric: model.Metric{"__name__": "avail", "device": "sdc", "fstype": "ext4"}, Value: 10},
+		{Metric: model.Metric{"__name__": "size", "device": "sda", "fstype": "ext4"}, Value: 100},
+		{Metric: model.Metric{"__name__": "size", "device": "sdb", "fstype": "ext4"}, Value: 20},
+	}
+	ratios, err := ratioSamples(samples, "avail", "size", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ratios) != 2 || ratios[0].Value != 0.25 || ratios[1].Value != 0.5 {
+		t.Errorf("unexpected ratios %v", ratios)
+	}
+	if ratios[0].Metric["__name__"] != "avail / size" || ratios[0].Metric["device"] != "sda" {
+		t.Errorf("unexpected labels %s", ratios[0].Metric)
+	}
+
+	if _, err := ratioSamples(samples, "avail", "size", []string{"fstype"}); err == nil {
+		t.Error("expected an error for denominators sharing the join labels")
+	}
+	ratios, err = ratioSamples(samples, "size", "avail", []string{"device"})
+	if err != nil || len(ratios) != 2 || ratios[0].Value != 4 {
+		t.Errorf("unexpected ratios %v (%v)", ratios, err)
+	}
+}
+
+func TestExecuteCheckRatio(t *testing.T) {
+	setupPlugin(t, "node_filesystem_avail_bytes{device=\"sda\"} 5\nnode_filesystem_size_bytes{device=\"sda\"} 100\n")
+	plugin.MetricNumerator = "node_filesystem_avail_bytes"
+	plugin.MetricDenominator = "node_filesystem_size_bytes"
+	plugin.Min = 0.1
+
+	if _, err := checkArgs(nil); err != nil {
+		t.Fatal(err)
+	}
+	out := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical below 10%% free, got %d (%v)", status, err)
+		}
+	})
+	if out != "Metric node_filesystem_avail_bytes / node_filesystem_size_bytes{device=\"sda\"} is at 0.050000. Check require minimum 0.100000\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	plugin.MetricDenominator = ""
+	if _, err := checkArgs(nil); err == nil {
+		t.Error("expected an error without --metric-denominator")
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	corev2 "github.com/sensu/core/v2"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+// checkReport is the result of a check printed with --output json.
+type checkReport struct {
+	Status         int            `json:"status"`
+	Metric         string         `json:"metric,omitempty"`
+	ScrapeDuration float64        `json:"scrape_duration_seconds"`
+	Thresholds     map[string]any `json:"thresholds"`
+	Series         []seriesReport `json:"series"`
+	Messages       []string       `json:"messages"`
+}
+
+// seriesReport is the evaluation of a single series.
+type seriesReport struct {
+	Series string            `json:"series"`
+	Labels map[string]string `json:"labels"`
+	Value  *float64          `json:"value"`
+	State  int               `json:"state"`
+}
+
+// report collects the result of the check with --output json, and is nil
+// otherwise.
+var report *checkReport
+
+// printf prints a line of check output, or collects it with --output json.
+func printf(format string, args ...any) {
+	if report != nil {
+		report.Messages = append(report.Messages, strings.TrimSuffix(fmt.Sprintf(format, args...), "\n"))
+		return
+	}
+	fmt.Printf(format, args...)
+}
+
+// printLine prints args as a line of check output like fmt.Println, or
+// collects it with --output json.
+func printLine(args ...any) {
+	if report != nil {
+		report.Messages = append(report.Messages, strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+		return
+	}
+	fmt.Println(args...)
+}
+
+// recordSeries adds the evaluation of a series to the report, in the worst
+// state of failures.
+func recordSeries(metric model.Metric, value float64, failures []failure) {
+	if report == nil {
+		return
+	}
+	labels := map[string]string{}
+	for name, value := range metric {
+		if name != model.MetricNameLabel {
+			labels[string(name)] = string(value)
+		}
+	}
+	state := sensu.CheckStateOK
+	for _, failure := range failures {
+		state = worstState(state, failure.State)
+	}
+	series := seriesReport{Series: seriesName(metric), Labels: labels, State: state}
+	// JSON can't hold NaN and infinities, they are reported as null.
+	if !math.IsNaN(value) && !math.IsInf(value, 0) {
+		series.Value = &value
+	}
+	report.Series = append(report.Series, series)
+}
+
+// reportThresholds returns the thresholds set on the check, keyed by option.
+func reportThresholds() map[string]any {
+	thresholds := map[string]any{}
+	for name, value := range map[string]float64{
+		"min":        plugin.Min,
+		"max":        plugin.Max,
+		"value":      plugin.Value,
+		"warn-min":   plugin.WarnMin,
+		"warn-max":   plugin.WarnMax,
+		"warn-value": plugin.WarnValue,
+		"delta-min":  plugin.DeltaMin,
+		"delta-max":  plugin.DeltaMax,
+	} {
+		if value != math.Pi {
+			thresholds[name] = value
+		}
+	}
+	for name, value := range map[string]string{
+		"critical":  plugin.Critical,
+		"warning":   plugin.Warning,
+		"condition": plugin.Condition,
+	} {
+		if value != "" {
+			thresholds[name] = value
+		}
+	}
+	return thresholds
+}
+
+// executeCheck evaluates the check, printing its result as text or, with
+// --output json, as a single JSON document.
+func executeCheck(event *corev2.Event) (int, error) {
+	if plugin.Output != "json" {
+		return evaluateCheck(event)
+	}
+	report = &checkReport{Thresholds: reportThresholds(), Series: []seriesReport{}, Messages: []string{}}
+	defer func() { report = nil }()
+	status, err := evaluateCheck(event)
+	if err != nil {
+		return status, err
+	}
+	report.Status = status
+	data, err := json.Marshal(report)
+	if err != nil {
+		return sensu.CheckStateUnknown, err
+	}
+	fmt.Println(string(data))
+	return status, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+func TestExecuteCheckOutputJSON(t *testing.T) {
+	setupPlugin(t, upMetrics+"up{instance=\"d\"} NaN\n")
+	plugin.Metrics = []string{"up"}
+	plugin.Min = 1
+	plugin.NaNState = "warning"
+	plugin.Output = "json"
+
+	output := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical, got %d (%v)", status, err)
+		}
+	})
+	var result checkReport
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatalf("expected a single JSON document, got %q (%v)", output, err)
+	}
+	if result.Status != sensu.CheckStateCritical || result.Metric != "up" || result.Thresholds["min"] != 1.0 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if len(result.Series) != 4 {
+		t.Fatalf("expected every series, got %+v", result.Series)
+	}
+	c, d := result.Series[2], result.Series[3]
+	if c.Labels["instance"] != "c" || c.Value == nil || *c.Value != 0 || c.State != sensu.CheckStateCritical {
+		t.Errorf("unexpected series %+v", c)
+	}
+	if d.Value != nil || d.State != sensu.CheckStateWarning {
+		t.Errorf("expected a null value for NaN, got %+v", d)
+	}
+	if len(result.Messages) != 2 || result.Messages[0] != "Metric up{instance=\"c\"} is at 0.000000. Check require minimum 1.000000" {
+		t.Errorf("unexpected messages %q", result.Messages)
+	}
+	if report != nil {
+		t.Error("expected the report to be reset")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/prometheus/common/model"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+	"gopkg.in/yaml.v3"
+)
+
+// rule is a single check of a --rules-file. Labels take --label specs and
+// Severity is the state returned when a threshold is breached.
+type rule struct {
+	Name     string   `yaml:"name"`
+	Metric   string   `yaml:"metric"`
+	Labels   []string `yaml:"labels"`
+	Min      *float64 `yaml:"min"`
+	Max      *float64 `yaml:"max"`
+	Value    *float64 `yaml:"value"`
+	Severity string   `yaml:"severity"`
+}
+
+// loadRules reads the rules of path, a YAML or JSON document with a list of
+// rules under a rules key. Rules without a name are named after their metric
+// and rules without a severity are critical.
+func loadRules(path string) ([]rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read rules file %s: %v", path, err)
+	}
+	var document struct {
+		Rules []rule `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("could not parse rules file %s: %v", path, err)
+	}
+	if len(document.Rules) == 0 {
+		return nil, fmt.Errorf("rules file %s defines no rules", path)
+	}
+	for i := range document.Rules {
+		r := &document.Rules[i]
+		if r.Metric == "" {
+			return nil, fmt.Errorf("rule %d of rules file %s has no metric", i+1, path)
+		}
+		if r.Min == nil && r.Max == nil && r.Value == nil {
+			return nil, fmt.Errorf("rule %d of rules file %s has no min, max or value", i+1, path)
+		}
+		if r.Name == "" {
+			r.Name = r.Metric
+		}
+		if r.Severity == "" {
+			r.Severity = "critical"
+		}
+		if _, ok := checkStates[r.Severity]; !ok {
+			return nil, fmt.Errorf("rule %s of rules file %s has invalid severity %s", r.Name, path, r.Severity)
+		}
+		if err := validateLabelSpecs(r.Labels); err != nil {
+			return nil, fmt.Errorf("rule %s of rules file %s: %v", r.Name, path, err)
+		}
+	}
+	return document.Rules, nil
+}
+
+// evaluateRules checks every rule against samples and returns the failures
+// found, with a missing metric reported as --missing-state.
+func evaluateRules(rules []rule, samples model.Vector) ([]failure, error) {
+	failures := []failure{}
+	for _, r := range rules {
+		matchers, err := parseLabelMatchers(r.Labels, plugin.LabelCI)
+		if err != nil {
+			return nil, err
+		}
+		state := checkStates[r.Severity]
+		found := false
+		for _, sample := range samples {
+			if sample.Metric[model.MetricNameLabel] != model.LabelValue(r.Metric) || !matchLabels(sample.Metric, matchers, false) {
+				continue
+			}
+			found = true
+			value := float64(sample.Value)
+			series := seriesName(sample.Metric)
+			if math.IsNaN(value) {
+				if plugin.NaNState != "ok" {
+					failures = append(failures, failure{checkStates[plugin.NaNState], fmt.Sprintf("Rule %s: metric %s is NaN", r.Name, series), 0})
+				}
+				continue
+			}
+			if r.Value != nil && value != *r.Value {
+				failures = append(failures, failure{state, fmt.Sprintf("Rule %s: metric %s is at %f. Check require value %f", r.Name, series, value, *r.Value), breach(value, *r.Value)})
+			}
+			if r.Min != nil && value < *r.Min {
+				failures = append(failures, failure{state, fmt.Sprintf("Rule %s: metric %s is at %f. Check require minimum %f", r.Name, series, value, *r.Min), breach(value, *r.Min)})
+			}
+			if r.Max != nil && value > *r.Max {
+				failures = append(failures, failure{state, fmt.Sprintf("Rule %s: metric %s is at %f. Check require maximum %f", r.Name, series, value, *r.Max), breach(value, *r.Max)})
+			}
+		}
+		if !found {
+			failures = append(failures, failure{checkStates[plugin.MissingState], fmt.Sprintf("Rule %s: metric %s not found", r.Name, r.Metric), 0})
+		}
+	}
+	return failures, nil
+}
+
+// rulesReport prints the failures of rules against samples and returns the
+// state of the check.
+func rulesReport(rules []rule, samples model.Vector) int {
+	failures, err := evaluateRules(rules, samples)
+	if err != nil {
+		printf("Failed: %s\n", err)
+		return sensu.CheckStateUnknown
+	}
+	printFailures(failures, plugin.MaxFailures)
+	status := sensu.CheckStateOK
+	for _, failure := range failures {
+		status = worstState(status, failure.State)
+	}
+	if len(failures) == 0 {
+		printf("All %d rules passed\n", len(rules))
+	}
+	return status
+}
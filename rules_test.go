@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+func writeRules(t *testing.T, rules string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.yml")
+	if err := os.WriteFile(path, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadRules(t *testing.T) {
+	rules, err := loadRules(writeRules(t, `rules:
+  - metric: node_load1
+    max: 4
+  - name: root filesystem
+    metric: node_filesystem_avail_bytes
+    labels: ["mountpoint:/"]
+    min: 1000
+    severity: warning
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[0].Name != "node_load1" || rules[0].Severity != "critical" || *rules[1].Min != 1000 {
+		t.Errorf("unexpected rules %+v", rules)
+	}
+
+	rules, err = loadRules(writeRules(t, `{"rules": [{"metric": "up", "value": 1}]}`))
+	if err != nil || len(rules) != 1 || *rules[0].Value != 1 {
+		t.Errorf("expected JSON rules to load, got %+v (%v)", rules, err)
+	}
+
+	for _, invalid := range []string{"rules: []", "rules: [{max: 1}]", "rules: [{metric: up}]", "rules: [{metric: up, max: 1, severity: bad}]"} {
+		if _, err := loadRules(writeRules(t, invalid)); err == nil {
+			t.Errorf("expected an error for rules %s", invalid)
+		}
+	}
+}
+
+func TestRulesReport(t *testing.T) {
+	saved := plugin
+	t.Cleanup(func() { plugin = saved })
+	plugin.MissingState, plugin.NaNState = "unknown", "ok"
+
+	max, min := 4.0, 1000.0
+	rules := []rule{
+		{Name: "load", Metric: "node_load1", Max: &max, Severity: "critical"},
+		{Name: "disk", Metric: "node_filesystem_avail_bytes", Labels: []string{"mountpoint:/"}, Min: &min, Severity: "warning"},
+	}
+	samples := model.Vector{
+		{Metric: model.Metric{"__name__": "node_load1"}, Value: 2},
+		{Metric: model.Metric{"__name__": "node_filesystem_avail_bytes", "mountpoint": "/"}, Value: 10},
+		{Metric: model.Metric{"__name__": "node_filesystem_avail_bytes", "mountpoint": "/boot"}, Value: 10},
+	}
+	var status int
+	output := captureOutput(t, func() { status = rulesReport(rules, samples) })
+	if status != sensu.CheckStateWarning || strings.Count(output, "\n") != 1 || !strings.Contains(output, `Rule disk: metric node_filesystem_avail_bytes{mountpoint="/"} is at 10`) {
+		t.Errorf("unexpected report %d %q", status, output)
+	}
+
+	output = captureOutput(t, func() { status = rulesReport(rules[:1], samples) })
+	if status != sensu.CheckStateOK || output != "All 1 rules passed\n" {
+		t.Errorf("unexpected report %d %q", status, output)
+	}
+}
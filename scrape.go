@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/proto"
+)
+
+// scrapeResult holds the outcome of scraping a single target.
+type scrapeResult struct {
+	Target   string
+	Families map[string]*dto.MetricFamily
+	Samples  model.Vector
+	Err      error
+}
+
+// scrapeTargets scrapes targets using up to concurrency workers. Results are
+// returned in the order of targets, whatever order the scrapes complete in.
+func scrapeTargets(targets []string, concurrency int) []scrapeResult {
+	results := make([]scrapeResult, len(targets))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	if concurrency > len(targets) {
+		concurrency = len(targets)
+	}
+	progress.scraping(len(targets))
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = scrapeTarget(targets[i])
+				progress.scrapedTarget()
+			}
+		}()
+	}
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// sampleTargets scrapes targets like scrapeTargets. With --sample-interval it
+// scrapes them a second time after the interval and returns the per-second
+// rate of every series between both scrapes instead of its value.
+func sampleTargets(targets []string, concurrency int) []scrapeResult {
+	start := time.Now()
+	first := scrapeTargets(targets, concurrency)
+	if plugin.SampleInterval <= 0 {
+		return first
+	}
+	time.Sleep(time.Duration(plugin.SampleInterval) * time.Second)
+	elapsed := time.Since(start)
+	results := scrapeTargets(targets, concurrency)
+	for i := range results {
+		if first[i].Err != nil {
+			results[i].Err = first[i].Err
+		}
+		if results[i].Err == nil {
+			results[i].Samples = intervalRates(first[i].Samples, results[i].Samples, elapsed)
+		}
+	}
+	return results
+}
+
+// intervalRates returns the per-second rate of the series of second since
+// first, sampled elapsed apart. Series missing from first are dropped.
+func intervalRates(first model.Vector, second model.Vector, elapsed time.Duration) model.Vector {
+	previous := map[string]float64{}
+	for _, sample := range first {
+		previous[sample.Metric.String()] = float64(sample.Value)
+	}
+	rates := model.Vector{}
+	for _, sample := range second {
+		value, ok := previous[sample.Metric.String()]
+		if !ok {
+			logger.Debug("series missing from the first sample", "series", sample.Metric.String())
+			continue
+		}
+		rate := counterDelta(float64(sample.Value), value) / elapsed.Seconds()
+		rates = append(rates, &model.Sample{Metric: sample.Metric, Value: model.SampleValue(rate), Timestamp: sample.Timestamp})
+	}
+	return rates
+}
+
+// scrapeTarget scrapes a single target, or queries it with --query, turning a
+// panic into an error so one misbehaving target can't take down the whole
+// check.
+func scrapeTarget(target string) (result scrapeResult) {
+	result.Target = target
+	defer func() {
+		if r := recover(); r != nil {
+			result.Err = fmt.Errorf("%s: panic while scraping: %v", target, r)
+		}
+	}()
+	if plugin.Query != "" && plugin.RangeDuration != "" {
+		result.Samples, result.Err = queryRangeTarget(target)
+		return result
+	}
+	if plugin.Query != "" {
+		result.Samples, result.Err = queryInstant(target, plugin.Query)
+		return result
+	}
+	if target == stdinTarget {
+		result.Families, result.Err = readStdin()
+		if result.Err == nil {
+			result.Samples = extractSamples(result.Families)
+		}
+		return result
+	}
+	result.Families, result.Err = QueryMetricFamilies(target, pluginCredentials(), plugin.insecureSkipVerify, plugin.Cert, plugin.Key, plugin.CaCert)
+	if result.Err == nil {
+		result.Samples = extractSamples(result.Families)
+	}
+	return result
+}
+
+// queryRangeTarget runs the --query range query configured by
+// --range-duration and --range-step on target.
+func queryRangeTarget(target string) (model.Vector, error) {
+	duration, err := model.ParseDuration(plugin.RangeDuration)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --range-duration %s: %v", plugin.RangeDuration, err)
+	}
+	step, err := model.ParseDuration(plugin.RangeStep)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --range-step %s: %v", plugin.RangeStep, err)
+	}
+	return queryRange(target, plugin.Query, time.Duration(duration), time.Duration(step), plugin.RangeFunction)
+}
+
+// stdinTarget is the target of --stdin, named like stdin is by most tools.
+const stdinTarget = "-"
+
+// stdin is read by --stdin, replaced by tests.
+var stdin io.Reader = os.Stdin
+
+// readStdin decodes the metrics piped to the check with --stdin.
+func readStdin() (map[string]*dto.MetricFamily, error) {
+	families, err := decodeFamilies(stdin, expfmt.NewFormat(expfmt.TypeTextPlain), wantedMetrics())
+	if err != nil {
+		return nil, fmt.Errorf("could not decode metrics from stdin: %v", err)
+	}
+	return families, nil
+}
+
+// acceptHeader asks exporters for the delimited protobuf format, which is
+// decoded one family at a time, falling back to the text format, then to
+// OpenMetrics for exporters serving nothing else.
+const acceptHeader = `application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7,text/plain;version=0.0.4;q=0.3,application/openmetrics-text;version=1.0.0;q=0.2,*/*;q=0.1`
+
+// decodeFamilies decodes the metric families of a scrape in format, keeping
+// the series of the families wanted only. Other families are kept without
+// their series so an exporter exposing no wanted metric can still be told
+// apart from an empty one. All series are kept when wanted is nil.
+func decodeFamilies(body io.Reader, format expfmt.Format, wanted []string) (map[string]*dto.MetricFamily, error) {
+	// The text parser reads the whole body at once, its lines are filtered
+	// before so the series of other families are never held in memory.
+	var filter *textFilter
+	if wanted != nil && format.FormatType() == expfmt.TypeTextPlain {
+		filter = newTextFilter(body, wanted)
+		body = filter
+	}
+	families := map[string]*dto.MetricFamily{}
+	decoder := expfmt.NewDecoder(body, format)
+	for {
+		family := &dto.MetricFamily{}
+		if err := decoder.Decode(family); err != nil {
+			if errors.Is(err, io.EOF) {
+				if filter != nil {
+					filter.addDropped(families)
+				}
+				return families, nil
+			}
+			return nil, err
+		}
+		if wanted != nil && !wantedFamily(family.GetName(), wanted) {
+			family.Metric = nil
+		}
+		families[family.GetName()] = family
+	}
+}
+
+// wantedFamily reports whether the family called name holds any of the
+// metrics wanted, including the _bucket, _sum and _count series of histograms
+// and summaries that are exposed under the name of their family.
+func wantedFamily(name string, wanted []string) bool {
+	for _, metric := range wanted {
+		if metric == name || strings.HasPrefix(metric, name+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// textFilter reads a scrape in the text format, dropping the lines of the
+// families that are not wanted. It tells families apart the way the text
+// parser does, _bucket, _sum and _count series belonging to the histogram or
+// summary declared under their base name.
+type textFilter struct {
+	lines   *bufio.Reader
+	wanted  []string
+	pending []byte
+	types   map[string]dto.MetricType
+	dropped map[string]bool
+}
+
+func newTextFilter(body io.Reader, wanted []string) *textFilter {
+	return &textFilter{
+		lines:   bufio.NewReader(body),
+		wanted:  wanted,
+		types:   map[string]dto.MetricType{},
+		dropped: map[string]bool{},
+	}
+}
+
+func (f *textFilter) Read(p []byte) (int, error) {
+	for len(f.pending) == 0 {
+		line, err := f.lines.ReadBytes('\n')
+		if len(line) > 0 && f.keep(line) {
+			f.pending = line
+		}
+		if err != nil {
+			if len(f.pending) > 0 {
+				break
+			}
+			return 0, err
+		}
+	}
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+	return n, nil
+}
+
+// keep reports whether line belongs to a wanted family, or is neither a
+// sample nor a HELP or TYPE comment.
+func (f *textFilter) keep(line []byte) bool {
+	text := strings.TrimLeft(string(line), " \t")
+	if strings.HasPrefix(text, "#") {
+		fields := strings.Fields(text)
+		if len(fields) < 3 || fields[0] != "#" || (fields[1] != "HELP" && fields[1] != "TYPE") {
+			return true
+		}
+		name := fields[2]
+		if _, ok := f.types[name]; !ok {
+			f.types[name] = dto.MetricType_UNTYPED
+		}
+		if fields[1] == "TYPE" && len(fields) > 3 {
+			if metricType, ok := dto.MetricType_value[strings.ToUpper(fields[3])]; ok {
+				f.types[name] = dto.MetricType(metricType)
+			}
+		}
+		return f.wantedName(name)
+	}
+	end := strings.IndexAny(text, "{ \t\r\n")
+	if end <= 0 {
+		return true
+	}
+	return f.wantedName(f.family(text[:end]))
+}
+
+// wantedName reports whether the family called name is wanted, remembering
+// it to be kept without its series otherwise.
+func (f *textFilter) wantedName(name string) bool {
+	if wantedFamily(name, f.wanted) {
+		return true
+	}
+	f.dropped[name] = true
+	return false
+}
+
+// family returns the name of the family a series called name belongs to.
+func (f *textFilter) family(name string) string {
+	if _, ok := f.types[name]; ok {
+		return name
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		base, ok := strings.CutSuffix(name, suffix)
+		if !ok {
+			continue
+		}
+		if metricType, ok := f.types[base]; ok && (metricType == dto.MetricType_HISTOGRAM || (metricType == dto.MetricType_SUMMARY && suffix != "_bucket")) {
+			return base
+		}
+	}
+	f.types[name] = dto.MetricType_UNTYPED
+	return name
+}
+
+// addDropped adds the families whose lines were dropped to families, without
+// their series.
+func (f *textFilter) addDropped(families map[string]*dto.MetricFamily) {
+	for name := range f.dropped {
+		if _, ok := families[name]; !ok {
+			families[name] = &dto.MetricFamily{Name: proto.String(name), Type: f.types[name].Enum()}
+		}
+	}
+}
+
+// wantedMetrics returns the names of the metrics the check evaluates, so
+// scrapes can drop unrelated families early. It returns nil when every family
+// is needed.
+func wantedMetrics() []string {
+	// --connect-test reports everything the exporters return.
+	if plugin.ConnectTest {
+		return nil
+	}
+	if plugin.Expr != "" {
+		expr, err := parseExpr(plugin.Expr)
+		if err != nil {
+			return nil
+		}
+		return exprMetrics(expr)
+	}
+	if plugin.MetricNumerator != "" {
+		return []string{plugin.MetricNumerator, plugin.MetricDenominator}
+	}
+	if len(plugin.Metrics) == 0 || plugin.MetricRegex {
+		return nil
+	}
+	return plugin.Metrics
+}
+
+// readTargets reads the scrape URLs listed in path, one per line. Blank lines
+// and lines starting with # are ignored.
+func readTargets(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read URLs file %s: %v", path, err)
+	}
+	defer file.Close()
+
+	targets := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		targets = append(targets, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read URLs file %s: %v", path, err)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("URLs file %s lists no URLs", path)
+	}
+	return targets, nil
+}
+
+// dedupeSamples keeps only the last sample of series exposed more than once,
+// as Prometheus does when ingesting a scrape. It returns the deduplicated
+// samples along with how many times each duplicated series was exposed, keyed
+// by its metric string.
+func dedupeSamples(samples model.Vector) (model.Vector, map[string]int) {
+	index := map[model.Fingerprint]int{}
+	counts := map[model.Fingerprint]int{}
+	deduped := model.Vector{}
+	for _, sample := range samples {
+		fingerprint := sample.Metric.Fingerprint()
+		counts[fingerprint] += 1
+		if i, ok := index[fingerprint]; ok {
+			deduped[i] = sample
+			continue
+		}
+		index[fingerprint] = len(deduped)
+		deduped = append(deduped, sample)
+	}
+
+	duplicates := map[string]int{}
+	for _, sample := range deduped {
+		if count := counts[sample.Metric.Fingerprint()]; count > 1 {
+			duplicates[sample.Metric.String()] = count
+		}
+	}
+	return deduped, duplicates
+}
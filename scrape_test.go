@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+func TestScrapeTargetsOrder(t *testing.T) {
+	targets := []string{}
+	for i := 0; i < 5; i++ {
+		value := i
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "target %d\n", value)
+		}))
+		t.Cleanup(server.Close)
+		targets = append(targets, server.URL)
+	}
+	targets = append(targets, "http://127.0.0.1:0/metrics")
+
+	results := scrapeTargets(targets, 3)
+	if len(results) != len(targets) {
+		t.Fatalf("expected %d results, got %d", len(targets), len(results))
+	}
+	for i, result := range results[:5] {
+		if result.Err != nil {
+			t.Fatalf("unexpected error for %s: %v", result.Target, result.Err)
+		}
+		if result.Target != targets[i] || len(result.Samples) != 1 || int(result.Samples[0].Value) != i {
+			t.Errorf("result %d out of order: %v", i, result)
+		}
+	}
+	if results[5].Err == nil {
+		t.Errorf("expected an error for an unreachable target")
+	}
+}
+
+func TestReadTargets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls")
+	if err := os.WriteFile(path, []byte("# exporters\nhttp://a/metrics\n\n  http://b/metrics  \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	targets, err := readTargets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 || targets[0] != "http://a/metrics" || targets[1] != "http://b/metrics" {
+		t.Errorf("unexpected targets %v", targets)
+	}
+}
+
+func TestDedupeSamples(t *testing.T) {
+	samples := model.Vector{
+		{Metric: model.Metric{"__name__": "up", "instance": "a"}, Value: 0},
+		{Metric: model.Metric{"__name__": "up", "instance": "b"}, Value: 1},
+		{Metric: model.Metric{"__name__": "up", "instance": "a"}, Value: 1},
+	}
+	deduped, duplicates := dedupeSamples(samples)
+	if len(deduped) != 2 {
+		t.Fatalf("expected 2 series, got %v", deduped)
+	}
+	if deduped[0].Metric["instance"] != "a" || deduped[0].Value != 1 {
+		t.Errorf("expected the last value of the duplicated series to be kept, got %v", deduped[0])
+	}
+	if len(duplicates) != 1 || duplicates[`up{instance="a"}`] != 2 {
+		t.Errorf("unexpected duplicates %v", duplicates)
+	}
+}
+
+func TestDecodeFamilies(t *testing.T) {
+	text := "# TYPE latency histogram\nlatency_bucket{le=\"+Inf\"} 3\nlatency_sum 1\nlatency_count 3\nunrelated 1\n"
+	families, err := decodeFamilies(strings.NewReader(text), expfmt.NewFormat(expfmt.TypeTextPlain), []string{"latency_count"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 2 || len(families["latency"].GetMetric()) != 1 || len(families["unrelated"].GetMetric()) != 0 {
+		t.Errorf("expected only the series of latency to be kept, got %v", families)
+	}
+
+	// The lines of other families never reach the parser.
+	other := "# HELP requests_total Requests.\n# TYPE requests_total counter\nrequests_total{code=\"200\"} 3\n# TYPE broken gauge\nbroken{code= 1\nerrors_total 2\n"
+	filtered, err := decodeFamilies(strings.NewReader(other), expfmt.NewFormat(expfmt.TypeTextPlain), []string{"errors_total"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered) != 3 || len(filtered["errors_total"].GetMetric()) != 1 || filtered["requests_total"].GetType() != dto.MetricType_COUNTER || filtered["broken"].GetType() != dto.MetricType_GAUGE {
+		t.Errorf("expected the other families to be kept without their series, got %v", filtered)
+	}
+
+	var body bytes.Buffer
+	encoder := expfmt.NewEncoder(&body, expfmt.NewFormat(expfmt.TypeProtoDelim))
+	for _, family := range families {
+		if err := encoder.Encode(family); err != nil {
+			t.Fatal(err)
+		}
+	}
+	families, err = decodeFamilies(&body, expfmt.NewFormat(expfmt.TypeProtoDelim), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 2 || len(families["latency"].GetMetric()) != 1 {
+		t.Errorf("expected the protobuf families to be decoded, got %v", families)
+	}
+}
+
+func TestIntervalRates(t *testing.T) {
+	first := model.Vector{
+		{Metric: model.Metric{"instance": "a"}, Value: 100},
+		{Metric: model.Metric{"instance": "b"}, Value: 100},
+	}
+	second := model.Vector{
+		{Metric: model.Metric{"instance": "a"}, Value: 120},
+		{Metric: model.Metric{"instance": "b"}, Value: 10},
+		{Metric: model.Metric{"instance": "c"}, Value: 5},
+	}
+	rates := intervalRates(first, second, 10*time.Second)
+	if len(rates) != 2 || rates[0].Value != 2 || rates[1].Value != 1 {
+		t.Errorf("unexpected rates %v", rates)
+	}
+}
+
+func TestExecuteCheckSampleInterval(t *testing.T) {
+	setupPlugin(t, "")
+	scrapes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scrapes++
+		fmt.Fprintf(w, "errors_total %d\n", scrapes*100)
+	}))
+	t.Cleanup(server.Close)
+	plugin.Urls = []string{server.URL}
+	plugin.Metrics = []string{"errors_total"}
+	plugin.SampleInterval = 1
+	plugin.Max = 10
+
+	out := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical at about 100 per second, got %d (%v)", status, err)
+		}
+	})
+	if scrapes != 2 || !strings.HasPrefix(out, "Metric errors_total is at a rate of ") {
+		t.Errorf("unexpected output %q after %d scrapes", out, scrapes)
+	}
+}
+
+func TestExecuteCheckStdin(t *testing.T) {
+	setupPlugin(t, "")
+	saved := stdin
+	t.Cleanup(func() { stdin = saved })
+	stdin = strings.NewReader(upMetrics)
+	plugin.Urls = []string{"http://127.0.0.1:1/metrics"}
+	plugin.Stdin = true
+	plugin.Metrics = []string{"up"}
+	plugin.Value = 1
+
+	out := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical for the series at 0, got %d (%v)", status, err)
+		}
+	})
+	if !strings.Contains(out, `instance="c"`) {
+		t.Errorf("expected the failing series read from stdin, got %q", out)
+	}
+
+	stdin = strings.NewReader("up{ 1\n")
+	out = captureOutput(t, func() {
+		if status, _ := executeCheck(nil); status != sensu.CheckStateUnknown {
+			t.Fatalf("expected invalid metrics to be unknown, got %d", status)
+		}
+	})
+	if !strings.Contains(out, "could not decode metrics from stdin") {
+		t.Errorf("unexpected output %q", out)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// metricSelected reports whether the metric called name is checked, by the
+// exact name of any --metric, by any --metric regex with --metric-regex, or
+// by --metric-prefix and --metric-suffix, which both have to match when given
+// together. Without any of them, as for --cardinality-by, every metric is
+// selected.
+func metricSelected(name string) bool {
+	if len(plugin.Metrics) == 0 && plugin.MetricPrefix == "" && plugin.MetricSuffix == "" {
+		return true
+	}
+	if plugin.MetricPrefix != "" || plugin.MetricSuffix != "" {
+		return strings.HasPrefix(name, plugin.MetricPrefix) && strings.HasSuffix(name, plugin.MetricSuffix)
+	}
+	for _, metric := range plugin.Metrics {
+		if !plugin.MetricRegex && name == metric {
+			return true
+		}
+		if plugin.MetricRegex {
+			if pattern, err := metricPattern(metric); err == nil && pattern.MatchString(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// metricPatterns caches compiled --metric regexes, as metricSelected is
+// called for every scraped series.
+var metricPatterns = map[string]*regexp.Regexp{}
+
+// metricPattern compiles metric as a regex that has to match the whole
+// metric name.
+func metricPattern(metric string) (*regexp.Regexp, error) {
+	if pattern, ok := metricPatterns[metric]; ok {
+		return pattern, nil
+	}
+	pattern, err := regexp.Compile("^(?:" + metric + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid metric regex '%s': %v", metric, err)
+	}
+	metricPatterns[metric] = pattern
+	return pattern, nil
+}
+
+// metricSelector describes the checked metrics for output, using * for the
+// part of the name left open by --metric-prefix and --metric-suffix, or the
+// query itself with --query.
+func metricSelector() string {
+	if plugin.Query != "" {
+		return plugin.Query
+	}
+	if plugin.MetricPrefix != "" || plugin.MetricSuffix != "" {
+		return plugin.MetricPrefix + "*" + plugin.MetricSuffix
+	}
+	return strings.Join(plugin.Metrics, ", ")
+}
+
+// missingMetrics returns the --metric names no sample has. Regexes and
+// prefixes select an open set of metrics, so none of them is ever missing.
+func missingMetrics(samples model.Vector) []string {
+	if plugin.MetricRegex {
+		return nil
+	}
+	missing := []string{}
+	for _, metric := range plugin.Metrics {
+		found := false
+		for _, sample := range samples {
+			if sample.Metric[model.MetricNameLabel] == model.LabelValue(metric) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, metric)
+		}
+	}
+	return missing
+}
+
+// nameExcluder drops metrics by exact name or by a regular expression that
+// has to match the whole name.
+type nameExcluder struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// parseExcludes parses --exclude entries. Every entry matches its exact
+// name, entries that are valid regular expressions also match any name they
+// fully match.
+func parseExcludes(entries []string) ([]nameExcluder, error) {
+	excludes := []nameExcluder{}
+	for _, entry := range entries {
+		if entry == "" {
+			return nil, fmt.Errorf("invalid exclude, metric name or regex can't be empty")
+		}
+		exclude := nameExcluder{Name: entry}
+		if pattern, err := regexp.Compile("^(?:" + entry + ")$"); err == nil {
+			exclude.Pattern = pattern
+		}
+		excludes = append(excludes, exclude)
+	}
+	return excludes, nil
+}
+
+// excluded reports whether metric is dropped by any of excludes.
+func excluded(metric model.Metric, excludes []nameExcluder) bool {
+	name := string(metric[model.MetricNameLabel])
+	for _, exclude := range excludes {
+		if name == exclude.Name || (exclude.Pattern != nil && exclude.Pattern.MatchString(name)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestExcluded(t *testing.T) {
+	excludes, err := parseExcludes([]string{"node_load1", "node_cpu_.*", "weird[name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]bool{
+		"node_load1":         true,
+		"node_load15":        false,
+		"node_cpu_seconds":   true,
+		"my_node_cpu_second": false,
+		"weird[name":         true,
+	} {
+		if got := excluded(model.Metric{model.MetricNameLabel: model.LabelValue(name)}, excludes); got != expected {
+			t.Errorf("expected %s excluded to be %t", name, expected)
+		}
+	}
+	if _, err := parseExcludes([]string{""}); err == nil {
+		t.Errorf("expected an error for an empty exclude")
+	}
+}
+
+func TestMetricSelected(t *testing.T) {
+	saved := plugin
+	t.Cleanup(func() { plugin = saved })
+
+	plugin.Metrics, plugin.MetricPrefix, plugin.MetricSuffix = nil, "node_", "_total"
+	for name, expected := range map[string]bool{
+		"node_cpu_total":  true,
+		"node_cpu":        false,
+		"go_gc_total":     false,
+		"node_load1":      false,
+		"node_disk_total": true,
+	} {
+		if got := metricSelected(name); got != expected {
+			t.Errorf("expected %s selected to be %t", name, expected)
+		}
+	}
+	if got := metricSelector(); got != "node_*_total" {
+		t.Errorf("unexpected selector %s", got)
+	}
+}
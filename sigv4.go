@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/sigv4"
+)
+
+// sigv4Transports caches the SigV4 round trippers created during a run by
+// region, so that the AWS credentials are looked up once.
+var sigv4Transports = struct {
+	sync.Mutex
+	transports map[string]http.RoundTripper
+}{transports: map[string]http.RoundTripper{}}
+
+// newSigV4Transport returns the transport signing the requests sent with next
+// for Amazon Managed Service for Prometheus in region, with the credentials
+// of the default AWS credential chain.
+func newSigV4Transport(region string, next http.RoundTripper) (http.RoundTripper, error) {
+	sigv4Transports.Lock()
+	defer sigv4Transports.Unlock()
+	rt, ok := sigv4Transports.transports[region]
+	if !ok {
+		var err error
+		if rt, err = sigv4.NewSigV4RoundTripper(&sigv4.SigV4Config{Region: region}, nextTransport{}); err != nil {
+			return nil, err
+		}
+		sigv4Transports.transports[region] = rt
+	}
+	return &sharedTransport{shared: rt, next: next}, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQueryMetricFamiliesSigV4(t *testing.T) {
+	setupPlugin(t, "")
+	reset := func() { sigv4Transports.transports = map[string]http.RoundTripper{} }
+	t.Cleanup(reset)
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_REGION", "AWS_ROLE_ARN", "AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_CONTAINER_CREDENTIALS_FULL_URI", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "missing"))
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte("[default]\nregion = us-east-1\n\n[profile monitoring]\naws_access_key_id = AKIDMONITORING\naws_secret_access_key = monitoring\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", path)
+	var request *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+	}))
+	t.Cleanup(server.Close)
+	target := server.URL + "/workspaces/ws-0123abcd/metrics"
+	plugin.Sigv4Region = "eu-west-1"
+
+	t.Setenv("AWS_PROFILE", "monitoring")
+	reset()
+	if _, err := QueryMetricFamilies(target, pluginCredentials(), false, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if auth := request.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDMONITORING/") || !strings.Contains(auth, "/eu-west-1/aps/aws4_request") || request.Header.Get("X-Amz-Date") == "" {
+		t.Errorf("expected a signature with the credentials of the profile, got %q", auth)
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "env")
+	t.Setenv("AWS_SESSION_TOKEN", "session")
+	reset()
+	if _, err := QueryMetricFamilies(target, pluginCredentials(), false, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if auth := request.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDENV/") || request.Header.Get("X-Amz-Security-Token") != "session" {
+		t.Errorf("expected a signature with the credentials of the environment first, got %q", auth)
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_PROFILE", "")
+	reset()
+	if _, err := QueryMetricFamilies(target, pluginCredentials(), false, "", "", ""); err == nil {
+		t.Error("expected an error without AWS credentials")
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+
+	"golang.org/x/net/proxy"
+)
+
+// socks5Dialer returns a dial function connecting through the --socks5 proxy,
+// given as [user:password@]host:port, with forward dialing the proxy itself.
+func socks5Dialer(forward *net.Dialer) (func(ctx context.Context, network string, address string) (net.Conn, error), error) {
+	u, err := url.Parse("socks5://" + plugin.Socks5)
+	if err != nil || u.Hostname() == "" || u.Port() == "" || u.Path != "" {
+		return nil, fmt.Errorf("invalid --socks5 %s, expected [user:password@]host:port", plugin.Socks5)
+	}
+	var auth *proxy.Auth
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth = &proxy.Auth{User: u.User.Username(), Password: password}
+	}
+	dialer, err := proxy.SOCKS5("tcp", u.Host, auth, forward)
+	if err != nil {
+		return nil, err
+	}
+	return dialer.(proxy.ContextDialer).DialContext, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// serveSocks5 accepts a single SOCKS5 connection requiring user and password
+// authentication and reports the address it was asked to connect to.
+func serveSocks5(t *testing.T, listener net.Listener, addresses chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 256)
+	read := func(n int) []byte {
+		if _, err := io.ReadFull(conn, buf[:n]); err != nil {
+			t.Error(err)
+		}
+		return buf[:n]
+	}
+	read(int(read(2)[1]))
+	conn.Write([]byte{5, 2})
+	user := string(read(int(read(2)[1])))
+	password := string(read(int(read(1)[0])))
+	if user != "sensu" || password != "secret" {
+		conn.Write([]byte{1, 1})
+		return
+	}
+	conn.Write([]byte{1, 0})
+
+	header := read(4)
+	var host string
+	switch header[3] {
+	case 1:
+		host = net.IP(read(4)).String()
+	case 3:
+		host = string(read(int(read(1)[0])))
+	}
+	port := read(2)
+	address := net.JoinHostPort(host, fmt.Sprint(int(port[0])<<8|int(port[1])))
+	addresses <- address
+	target, err := net.Dial("tcp", address)
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+func TestQueryMetricFamiliesSocks5(t *testing.T) {
+	setupPlugin(t, upMetrics)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	addresses := make(chan string, 1)
+	go serveSocks5(t, listener, addresses)
+
+	plugin.Socks5 = "sensu:secret@" + listener.Addr().String()
+	families, err := QueryMetricFamilies(plugin.Urls[0], pluginCredentials(), false, "", "", "")
+	if err != nil || families["up"] == nil {
+		t.Fatalf("expected the scrape to go through the SOCKS5 proxy, got %v", err)
+	}
+	if address := <-addresses; address != strings.TrimPrefix(plugin.Urls[0], "http://") {
+		t.Errorf("expected the proxy to connect to the exporter, got %s", address)
+	}
+}
+
+func TestSocks5DialerInvalid(t *testing.T) {
+	setupPlugin(t, "")
+	for _, value := range []string{"proxy", "proxy:1080/path", ":1080"} {
+		plugin.Socks5 = value
+		if _, err := socks5Dialer(&net.Dialer{}); err == nil {
+			t.Errorf("expected --socks5 %s to be rejected", value)
+		}
+	}
+}
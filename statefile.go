@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// seriesState is the value of a series persisted between runs, along with the
+// unix time it was recorded at and the unix time it last changed.
+type seriesState struct {
+	Value     float64 `json:"value"`
+	Timestamp int64   `json:"timestamp"`
+	Changed   int64   `json:"changed,omitempty"`
+}
+
+// changedAt returns when the value last changed, falling back to when it was
+// recorded for state written before changes were tracked.
+func (s seriesState) changedAt() int64 {
+	if s.Changed == 0 {
+		return s.Timestamp
+	}
+	return s.Changed
+}
+
+// loadState reads the series state persisted by a previous run, keyed by the
+// series' metric string. A missing file is a first run and yields no state.
+func loadState(path string) (map[string]seriesState, error) {
+	state := map[string]seriesState{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read state file %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("could not parse state file %s: %v", path, err)
+	}
+	return state, nil
+}
+
+// saveState replaces the state file with state. The file is written next to
+// its destination and renamed into place so a concurrent run never reads a
+// partial file.
+func saveState(path string, state map[string]seriesState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("could not write state file %s: %v", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write state file %s: %v", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write state file %s: %v", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("could not write state file %s: %v", path, err)
+	}
+	return nil
+}
+
+// counterDelta returns how much a counter grew from previous to current. A
+// value lower than the previous one means the counter was reset, in which case
+// it grew by its current value.
+func counterDelta(current float64, previous float64) float64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
+
+// counterRates returns the per-second rate of every counter in samples since
+// its previous sample, recording the current samples in state for the next
+// run. Series without a previous sample only have their value recorded.
+func counterRates(samples model.Vector, previous map[string]seriesState, state map[string]seriesState, now time.Time) model.Vector {
+	rates := model.Vector{}
+	for _, sample := range samples {
+		key := sample.Metric.String()
+		state[key] = seriesState{Value: float64(sample.Value), Timestamp: now.Unix()}
+		last, ok := previous[key]
+		if !ok || now.Unix() <= last.Timestamp {
+			logger.Debug("no previous sample to compute a rate from", "series", key)
+			continue
+		}
+		rate := counterDelta(float64(sample.Value), last.Value) / float64(now.Unix()-last.Timestamp)
+		rates = append(rates, &model.Sample{Metric: sample.Metric, Value: model.SampleValue(rate), Timestamp: sample.Timestamp})
+	}
+	return rates
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	state, err := loadState(path)
+	if err != nil || len(state) != 0 {
+		t.Fatalf("expected empty state on first run, got %v (%v)", state, err)
+	}
+
+	state["up"] = seriesState{Value: 1, Timestamp: 42}
+	if err := saveState(path, state); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded["up"] != state["up"] {
+		t.Errorf("expected %v, got %v", state["up"], loaded["up"])
+	}
+}
+
+func TestCounterDelta(t *testing.T) {
+	if delta := counterDelta(150, 100); delta != 50 {
+		t.Errorf("expected 50, got %f", delta)
+	}
+	if delta := counterDelta(20, 100); delta != 20 {
+		t.Errorf("expected a reset counter to count from zero, got %f", delta)
+	}
+}
+
+func TestCounterRates(t *testing.T) {
+	now := time.Unix(1000, 0)
+	samples := model.Vector{
+		{Metric: model.Metric{"instance": "a"}, Value: 150},
+		{Metric: model.Metric{"instance": "b"}, Value: 20},
+		{Metric: model.Metric{"instance": "c"}, Value: 5},
+	}
+	previous := map[string]seriesState{
+		`{instance="a"}`: {Value: 100, Timestamp: 990},
+		`{instance="b"}`: {Value: 100, Timestamp: 990},
+	}
+	state := map[string]seriesState{}
+	rates := counterRates(samples, previous, state, now)
+	if len(rates) != 2 || rates[0].Value != 5 || rates[1].Value != 2 {
+		t.Errorf("unexpected rates %v", rates)
+	}
+	if len(state) != 3 || state[`{instance="c"}`].Value != 5 || state[`{instance="c"}`].Timestamp != 1000 {
+		t.Errorf("expected every sample to be recorded, got %v", state)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+// checkStates maps the state names accepted by options such as --empty-state
+// to their check exit status.
+var checkStates = map[string]int{
+	"ok":       sensu.CheckStateOK,
+	"warning":  sensu.CheckStateWarning,
+	"critical": sensu.CheckStateCritical,
+	"unknown":  sensu.CheckStateUnknown,
+}
+
+// stateNames lists the accepted state names, for use as option Allow values.
+var stateNames = []string{"ok", "warning", "critical", "unknown"}
+
+// worstState returns the more severe of two check states.
+func worstState(a int, b int) int {
+	if b > a {
+		return b
+	}
+	return a
+}
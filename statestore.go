@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	corev2 "github.com/sensu/core/v2"
+)
+
+// stateStore persists series state between runs.
+type stateStore interface {
+	load() (map[string]seriesState, error)
+	save(state map[string]seriesState) error
+}
+
+// newStateStore returns the store selected by --state-backend.
+func newStateStore() stateStore {
+	if plugin.StateBackend == "event" {
+		return newEventStore()
+	}
+	return fileStore{path: plugin.StateFile}
+}
+
+// newEventStore returns the store of the entity set by the Sensu options.
+func newEventStore() *eventStore {
+	return &eventStore{
+		apiURL:    plugin.SensuAPIURL,
+		apiKey:    plugin.SensuAPIKey,
+		namespace: plugin.SensuNamespace,
+		entity:    plugin.SensuEntity,
+		check:     plugin.SensuCheck,
+	}
+}
+
+// stateConfigured reports whether somewhere to persist state between runs is
+// configured.
+func stateConfigured() bool {
+	return plugin.StateFile != "" || plugin.StateBackend == "event"
+}
+
+// fileStore keeps state in a local file.
+type fileStore struct {
+	path string
+}
+
+func (s fileStore) load() (map[string]seriesState, error) {
+	return loadState(s.path)
+}
+
+func (s fileStore) save(state map[string]seriesState) error {
+	return saveState(s.path, state)
+}
+
+// sensuClient is the HTTP client used for the Sensu API.
+var sensuClient = &http.Client{Timeout: 10 * time.Second}
+
+// eventStore keeps state in an annotation of the entity of the check's event
+// through the Sensu API, for agents that can't write local files. Events are
+// replaced by every check result, their entity is not.
+type eventStore struct {
+	apiURL    string
+	apiKey    string
+	namespace string
+	entity    string
+	check     string
+}
+
+// annotation returns the name of the annotation holding the check's state.
+func (s *eventStore) annotation() string {
+	return "sensu-prometheus-metrics-checks/state/" + s.check
+}
+
+// entityURL returns the Sensu API URL of the entity.
+func (s *eventStore) entityURL() string {
+	return fmt.Sprintf("%s/api/core/v2/namespaces/%s/entities/%s", strings.TrimSuffix(s.apiURL, "/"), url.PathEscape(s.namespace), url.PathEscape(s.entity))
+}
+
+// do sends a request to the Sensu API and returns the response if its status
+// is OK, which the caller has to close.
+func (s *eventStore) do(method string, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.entityURL(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Key "+s.apiKey)
+	req.Header.Set("User-Agent", userAgent())
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	response, err := sensuClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach Sensu API: %v", err)
+	}
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNoContent {
+		response.Body.Close()
+		return nil, fmt.Errorf("Sensu API returned %s for entity %s", response.Status, s.entity)
+	}
+	return response, nil
+}
+
+// fetchEntity returns the entity from the Sensu API.
+func (s *eventStore) fetchEntity() (*corev2.Entity, error) {
+	response, err := s.do(http.MethodGet, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var entity corev2.Entity
+	if err := json.NewDecoder(response.Body).Decode(&entity); err != nil {
+		return nil, fmt.Errorf("could not parse Sensu entity %s: %v", s.entity, err)
+	}
+	return &entity, nil
+}
+
+func (s *eventStore) load() (map[string]seriesState, error) {
+	entity, err := s.fetchEntity()
+	if err != nil {
+		return nil, err
+	}
+	state := map[string]seriesState{}
+	data, ok := entity.Annotations[s.annotation()]
+	if !ok {
+		return state, nil
+	}
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		return nil, fmt.Errorf("could not parse state annotation of entity %s: %v", s.entity, err)
+	}
+	return state, nil
+}
+
+func (s *eventStore) save(state map[string]seriesState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{s.annotation(): string(data)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	response, err := s.do(http.MethodPatch, "application/merge-patch+json", patch)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
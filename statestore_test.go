@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+// setupSensuAPI points the event state backend at a test Sensu API serving
+// the entity web-1 with annotations, which PATCH requests merge into.
+func setupSensuAPI(t *testing.T, annotations map[string]string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/core/v2/namespaces/default/entities/web-1" || r.Header.Get("Authorization") != "Key secret" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(map[string]any{"metadata": map[string]any{"name": "web-1", "annotations": annotations}})
+		case http.MethodPatch:
+			body, _ := io.ReadAll(r.Body)
+			var patch struct {
+				Metadata struct {
+					Annotations map[string]string `json:"annotations"`
+				} `json:"metadata"`
+			}
+			if r.Header.Get("Content-Type") != "application/merge-patch+json" || json.Unmarshal(body, &patch) != nil {
+				http.Error(w, "bad patch", http.StatusBadRequest)
+				return
+			}
+			for key, value := range patch.Metadata.Annotations {
+				annotations[key] = value
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(server.Close)
+	plugin.StateBackend = "event"
+	plugin.SensuAPIURL = server.URL
+	plugin.SensuAPIKey = "secret"
+	plugin.SensuNamespace = "default"
+	plugin.SensuEntity = "web-1"
+	plugin.SensuCheck = "errors"
+}
+
+func TestEventStore(t *testing.T) {
+	setupPlugin(t, "")
+	annotations := map[string]string{"owner": "ops"}
+	setupSensuAPI(t, annotations)
+
+	store := newStateStore()
+	state, err := store.load()
+	if err != nil || len(state) != 0 {
+		t.Fatalf("expected no state before the first run, got %v (%v)", state, err)
+	}
+	if err := store.save(map[string]seriesState{"errors_total": {Value: 5, Timestamp: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	state, err = store.load()
+	if err != nil || state["errors_total"].Value != 5 {
+		t.Errorf("expected the saved state, got %v (%v)", state, err)
+	}
+	if annotations["owner"] != "ops" {
+		t.Errorf("expected other annotations to be kept, got %v", annotations)
+	}
+
+	plugin.SensuEntity = "web-2"
+	if _, err := newStateStore().load(); err == nil {
+		t.Error("expected an error for an unknown entity")
+	}
+}
+
+func TestExecuteCheckEventState(t *testing.T) {
+	setupPlugin(t, "errors_total 100\n")
+	setupSensuAPI(t, map[string]string{
+		"sensu-prometheus-metrics-checks/state/errors": `{"errors_total":{"value":50,"timestamp":1}}`,
+	})
+	plugin.Metrics = []string{"errors_total"}
+	plugin.DeltaMax = 10
+
+	if _, err := checkArgs(nil); err != nil {
+		t.Fatal(err)
+	}
+	status, err := executeCheck(nil)
+	if err != nil || status != sensu.CheckStateCritical {
+		t.Fatalf("expected critical after growing by 50, got %d (%v)", status, err)
+	}
+	status, err = executeCheck(nil)
+	if err != nil || status != sensu.CheckStateOK {
+		t.Fatalf("expected OK without change, got %d (%v)", status, err)
+	}
+
+	plugin.SensuAPIKey = ""
+	if _, err := checkArgs(nil); err == nil {
+		t.Error("expected an error without --sensu-api-key")
+	}
+}
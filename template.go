@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"text/template"
+
+	"github.com/prometheus/common/model"
+	corev2 "github.com/sensu/core/v2"
+)
+
+// templateData is what --output-template renders for every failure of a
+// series. Thresholds that are not set are NaN.
+type templateData struct {
+	Series    string
+	Name      string
+	Labels    map[string]string
+	Value     float64
+	State     int
+	Message   string
+	Min       float64
+	Max       float64
+	Expected  float64
+	WarnMin   float64
+	WarnMax   float64
+	WarnValue float64
+}
+
+// parseOutputTemplate parses the --output-template.
+func parseOutputTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("output").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --output-template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// threshold returns the threshold value, or NaN when it is not set.
+func threshold(value float64) float64 {
+	if value == math.Pi {
+		return math.NaN()
+	}
+	return value
+}
+
+// templateFailures replaces the messages of the failures of a series by tmpl
+// rendered with the series, its scaled value and the thresholds. A failure
+// the template can't be rendered for keeps its message.
+func templateFailures(tmpl *template.Template, metric model.Metric, value float64, failures []failure) {
+	labels := map[string]string{}
+	for name, value := range metric {
+		if name != model.MetricNameLabel {
+			labels[string(name)] = string(value)
+		}
+	}
+	for i := range failures {
+		data := templateData{
+			Series:    seriesName(metric),
+			Name:      string(metric[model.MetricNameLabel]),
+			Labels:    labels,
+			Value:     value,
+			State:     failures[i].State,
+			Message:   failures[i].Message,
+			Min:       threshold(plugin.Min),
+			Max:       threshold(plugin.Max),
+			Expected:  threshold(plugin.Value),
+			WarnMin:   threshold(plugin.WarnMin),
+			WarnMax:   threshold(plugin.WarnMax),
+			WarnValue: threshold(plugin.WarnValue),
+		}
+		var message strings.Builder
+		if err := tmpl.Execute(&message, data); err != nil {
+			logger.Warn("could not render --output-template", "series", data.Series, "err", err)
+			continue
+		}
+		failures[i].Message = message.String()
+	}
+}
+
+// entityTemplateData is what templates in --url, --fallback-url,
+// --compare-url and --label render, e.g. {{ .Entity.Name }} or
+// {{ index .Entity.Labels "exporter_port" }}.
+type entityTemplateData struct {
+	Entity *corev2.Entity
+}
+
+// renderEntityTemplates renders the templates of the target options with the
+// --sensu-entity entity of the Sensu API, as the check doesn't read its event
+// from stdin.
+func renderEntityTemplates() error {
+	type templated struct {
+		option string
+		value  *string
+	}
+	options := []templated{}
+	for i := range plugin.Urls {
+		if strings.Contains(plugin.Urls[i], "{{") {
+			options = append(options, templated{"url", &plugin.Urls[i]})
+		}
+	}
+	for _, option := range []templated{{"fallback-url", &plugin.FallbackUrl}, {"compare-url", &plugin.CompareUrl}} {
+		if strings.Contains(*option.value, "{{") {
+			options = append(options, option)
+		}
+	}
+	for i := range plugin.Labels {
+		if strings.Contains(plugin.Labels[i], "{{") {
+			options = append(options, templated{"label", &plugin.Labels[i]})
+		}
+	}
+	if len(options) == 0 {
+		return nil
+	}
+
+	if plugin.SensuAPIKey == "" || plugin.SensuEntity == "" {
+		return errors.New("templates in --url, --fallback-url, --compare-url or --label require --sensu-api-key and --sensu-entity")
+	}
+	entity, err := newEventStore().fetchEntity()
+	if err != nil {
+		return err
+	}
+	data := entityTemplateData{Entity: entity}
+	for _, option := range options {
+		tmpl, err := template.New(option.option).Option("missingkey=error").Parse(*option.value)
+		if err != nil {
+			return fmt.Errorf("invalid template in --%s: %v", option.option, err)
+		}
+		var rendered strings.Builder
+		if err := tmpl.Execute(&rendered, data); err != nil {
+			return fmt.Errorf("could not render --%s: %v", option.option, err)
+		}
+		logger.Debug("rendered template", "option", option.option, "value", rendered.String())
+		*option.value = rendered.String()
+	}
+	return nil
+}
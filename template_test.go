@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev2 "github.com/sensu/core/v2"
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+func TestExecuteCheckOutputTemplate(t *testing.T) {
+	setupPlugin(t, upMetrics)
+	plugin.Metrics = []string{"up"}
+	plugin.Min = 1
+	plugin.OutputTemplate = "{{.Labels.instance}} is {{.Value}} < {{.Min}} ({{.State}}, max {{.Max}})"
+
+	if _, err := checkArgs(nil); err != nil {
+		t.Fatal(err)
+	}
+	output := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical, got %d (%v)", status, err)
+		}
+	})
+	if output != "c is 0 < 1 (2, max NaN)\n" {
+		t.Errorf("unexpected output %q", output)
+	}
+
+	plugin.OutputTemplate = "{{.Value"
+	if _, err := checkArgs(nil); err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+}
+
+func TestRenderEntityTemplates(t *testing.T) {
+	setupPlugin(t, "")
+	entity := corev2.FixtureEntity("web-1")
+	entity.Labels = map[string]string{"exporter_port": "9100", "role": "web"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/core/v2/namespaces/default/entities/web-1" || r.Header.Get("Authorization") != "Key secret" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(entity)
+	}))
+	t.Cleanup(server.Close)
+
+	set := func() {
+		plugin.Urls = []string{`http://{{ .Entity.Name }}:{{ index .Entity.Labels "exporter_port" }}/metrics`}
+		plugin.Labels = []string{"role:{{ .Entity.Labels.role }}", "job:node"}
+	}
+	set()
+	if err := renderEntityTemplates(); err == nil {
+		t.Error("expected templates without the Sensu API to be an error")
+	}
+	plugin.SensuAPIURL, plugin.SensuAPIKey, plugin.SensuNamespace, plugin.SensuEntity = server.URL, "secret", "default", "web-1"
+	if err := renderEntityTemplates(); err != nil || plugin.Urls[0] != "http://web-1:9100/metrics" || plugin.Labels[0] != "role:web" || plugin.Labels[1] != "job:node" {
+		t.Errorf("unexpected rendering with the Sensu API entity: %s %v (%v)", plugin.Urls[0], plugin.Labels, err)
+	}
+
+	plugin.Urls = []string{"http://{{ .Entity.Labels.missing }}/metrics"}
+	if err := renderEntityTemplates(); err == nil {
+		t.Error("expected a missing label to be an error")
+	}
+}
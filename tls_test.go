@@ -0,0 +1,28 @@
+package main
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestParseTLSVersion(t *testing.T) {
+	if version, err := parseTLSVersion("1.2"); err != nil || version != tls.VersionTLS12 {
+		t.Errorf("expected TLS 1.2, got %d (%v)", version, err)
+	}
+	if version, err := parseTLSVersion(""); err != nil || version != 0 {
+		t.Errorf("expected the default version, got %d (%v)", version, err)
+	}
+	if _, err := parseTLSVersion("1.4"); err == nil {
+		t.Errorf("expected an error for TLS 1.4")
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	ids, err := parseCipherSuites([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"})
+	if err != nil || len(ids) != 1 || ids[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("unexpected cipher suites %v (%v)", ids, err)
+	}
+	if _, err := parseCipherSuites([]string{"TLS_NOT_A_SUITE"}); err == nil {
+		t.Errorf("expected an error for an unknown cipher suite")
+	}
+}
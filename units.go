@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// units maps the --unit names to the number of base units they stand for. The
+// empty unit leaves values as they are.
+var units = map[string]float64{
+	"":   1,
+	"K":  1e3,
+	"M":  1e6,
+	"G":  1e9,
+	"T":  1e12,
+	"Ki": 1 << 10,
+	"Mi": 1 << 20,
+	"Gi": 1 << 30,
+	"Ti": 1 << 40,
+}
+
+// unitNames lists the accepted --unit names, for use as option Allow values.
+var unitNames = []string{"K", "M", "G", "T", "Ki", "Mi", "Gi", "Ti"}
+
+// byteUnits are the IEC units --humanize renders byte values in.
+var byteUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// humanize renders a scaled value of the metric called name for on-call
+// staff, picking the unit from the name's _bytes, _seconds, _ratio or
+// _percent suffix or else from --unit.
+func humanize(value float64, name string) string {
+	base := value * units[plugin.Unit]
+	switch {
+	case math.IsNaN(value) || math.IsInf(value, 0):
+		return fmt.Sprintf("%f", value)
+	case strings.HasSuffix(name, "_bytes"):
+		i := 0
+		for math.Abs(base) >= 1024 && i < len(byteUnits)-1 {
+			base /= 1024
+			i++
+		}
+		return trimDecimal(base) + " " + byteUnits[i]
+	case strings.HasSuffix(name, "_seconds"):
+		switch abs := math.Abs(base); {
+		case abs == 0:
+			return "0s"
+		case abs < 1e-3:
+			return trimDecimal(base*1e6) + "µs"
+		case abs < 1:
+			return trimDecimal(base*1e3) + "ms"
+		case abs < 60:
+			return trimDecimal(base) + "s"
+		}
+		return time.Duration(base * float64(time.Second)).Round(time.Second).String()
+	case strings.HasSuffix(name, "_ratio"):
+		return trimDecimal(base*100) + "%"
+	case strings.HasSuffix(name, "_percent"):
+		return trimDecimal(base) + "%"
+	case plugin.Unit != "":
+		return trimDecimal(value) + " " + plugin.Unit
+	}
+	return trimDecimal(value)
+}
+
+// trimDecimal formats value with one decimal, dropping it when it is zero.
+func trimDecimal(value float64) string {
+	return strings.TrimSuffix(strconv.FormatFloat(value, 'f', 1, 64), ".0")
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/sensu/sensu-plugin-sdk/sensu"
+)
+
+func TestHumanize(t *testing.T) {
+	setupPlugin(t, "")
+	tests := []struct {
+		value float64
+		name  string
+		unit  string
+		want  string
+	}{
+		{1610612736, "node_memory_bytes", "", "1.5 GiB"},
+		{512, "node_memory_bytes", "", "512 B"},
+		{1.5, "node_memory_bytes", "Gi", "1.5 GiB"},
+		{0.25, "http_request_duration_seconds", "", "250ms"},
+		{0.00002, "http_request_duration_seconds", "", "20µs"},
+		{12.34, "http_request_duration_seconds", "", "12.3s"},
+		{150, "age_seconds", "", "2m30s"},
+		{0.423, "cache_hit_ratio", "", "42.3%"},
+		{42.34, "cpu_percent", "", "42.3%"},
+		{12, "queue_length", "K", "12 K"},
+		{3, "queue_length", "", "3"},
+	}
+	for _, test := range tests {
+		plugin.Unit = test.unit
+		if got := humanize(test.value, test.name); got != test.want {
+			t.Errorf("%s %g: expected %s, got %s", test.name, test.value, test.want, got)
+		}
+	}
+}
+
+func TestExecuteCheckHumanize(t *testing.T) {
+	setupPlugin(t, "node_memory_used_bytes 3221225472\n")
+	plugin.Metrics = []string{"node_memory_used_bytes"}
+	plugin.Max = 2147483648
+	plugin.Humanize = true
+
+	out := captureOutput(t, func() {
+		status, err := executeCheck(nil)
+		if err != nil || status != sensu.CheckStateCritical {
+			t.Fatalf("expected critical, got %d (%v)", status, err)
+		}
+	})
+	if out != "Metric node_memory_used_bytes is at 3 GiB. Check require maximum 2 GiB\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+}
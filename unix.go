@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/prometheus/common/config"
+)
+
+// unixTransport sends the requests for a unix:// URL over the Unix socket its
+// path starts with, requesting the rest of the path over HTTP.
+type unixTransport struct {
+	transport http.RoundTripper
+	path      string
+}
+
+// newUnixTransport returns the transport of the unix:// URL target, sending
+// the requests with the transport newTransport returns for a dial function
+// connecting to its socket with dialer.
+func newUnixTransport(target string, dialer *net.Dialer, newTransport func(config.DialContextFunc) (http.RoundTripper, error)) (*unixTransport, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	socket, path, err := splitUnixPath(u.Path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", u.Redacted(), err)
+	}
+	logger.Debug("scraping over Unix socket", "socket", socket, "path", path)
+	transport, err := newTransport(func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", socket)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &unixTransport{transport: transport, path: path}, nil
+}
+
+func (t *unixTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.URL = &url.URL{Scheme: "http", Host: "localhost", Path: t.path, RawQuery: req.URL.RawQuery}
+	if out.Host == "" {
+		out.Host = "localhost"
+	}
+	return t.transport.RoundTrip(out)
+}
+
+// splitUnixPath splits the path of a unix:// URL into the path of the socket,
+// its longest prefix that is a Unix socket, and the HTTP path requested,
+// /metrics when nothing follows the socket.
+func splitUnixPath(path string) (string, string, error) {
+	for end := len(path); end > 0; end = strings.LastIndex(path[:end], "/") {
+		if info, err := os.Stat(path[:end]); err == nil && info.Mode()&os.ModeSocket != 0 {
+			rest := path[end:]
+			if rest == "" || rest == "/" {
+				rest = "/metrics"
+			}
+			return path[:end], rest, nil
+		}
+	}
+	return "", "", fmt.Errorf("no Unix socket found in %s", path)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQueryMetricFamiliesUnixSocket(t *testing.T) {
+	setupPlugin(t, "")
+	socket := filepath.Join(t.TempDir(), "exporter.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.RequestURI())
+		fmt.Fprint(w, upMetrics)
+	})}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	for _, target := range []string{"unix://" + socket, "unix://" + socket + "/custom/metrics?format=text"} {
+		families, err := QueryMetricFamilies(target, pluginCredentials(), false, "", "", "")
+		if err != nil || len(families["up"].GetMetric()) != 3 {
+			t.Fatalf("expected %s to be scraped, got %v (%v)", target, families, err)
+		}
+	}
+	if strings.Join(paths, ",") != "/metrics,/custom/metrics?format=text" {
+		t.Errorf("unexpected request paths %v", paths)
+	}
+
+	if _, err := QueryMetricFamilies("unix://"+filepath.Dir(socket)+"/missing.sock/metrics", pluginCredentials(), false, "", "", ""); err == nil || !strings.Contains(err.Error(), "no Unix socket found") {
+		t.Errorf("expected a missing socket to be an error, got %v", err)
+	}
+}
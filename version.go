@@ -0,0 +1,16 @@
+package main
+
+import "runtime/debug"
+
+// userAgent returns the User-Agent header sent to exporters, identifying the
+// check and the module version it was built from unless --user-agent is set.
+func userAgent() string {
+	if plugin.UserAgent != "" {
+		return plugin.UserAgent
+	}
+	version := "dev"
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		version = info.Main.Version
+	}
+	return "sensu-prometheus-metrics-checks/" + version
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// activeWindow is a weekly schedule of when thresholds apply, as days of the
+// week and a time of day range in minutes since midnight.
+type activeWindow struct {
+	Days  [7]bool
+	Start int
+	End   int
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// parseActiveWindow parses an --active-window spec such as
+// Mon-Fri 09:00-17:00. Days are given as single days or ranges separated by
+// commas and can be left out to apply every day. A time range that ends
+// before it starts spans midnight.
+func parseActiveWindow(spec string) (activeWindow, error) {
+	window := activeWindow{}
+	fields := strings.Fields(spec)
+	if len(fields) == 0 || len(fields) > 2 {
+		return window, fmt.Errorf("invalid active window '%s', expected days and HH:MM-HH:MM", spec)
+	}
+	if len(fields) == 1 {
+		for i := range window.Days {
+			window.Days[i] = true
+		}
+	} else {
+		for _, days := range strings.Split(fields[0], ",") {
+			from, to, isRange := strings.Cut(days, "-")
+			first, ok := weekdays[strings.ToLower(from)]
+			last := first
+			if ok && isRange {
+				last, ok = weekdays[strings.ToLower(to)]
+			}
+			if !ok {
+				return window, fmt.Errorf("invalid active window '%s', unknown days '%s'", spec, days)
+			}
+			for day := first; ; day = (day + 1) % 7 {
+				window.Days[day] = true
+				if day == last {
+					break
+				}
+			}
+		}
+	}
+
+	from, to, ok := strings.Cut(fields[len(fields)-1], "-")
+	if !ok {
+		return window, fmt.Errorf("invalid active window '%s', expected a time range HH:MM-HH:MM", spec)
+	}
+	var err error
+	if window.Start, err = parseTimeOfDay(from); err != nil {
+		return window, fmt.Errorf("invalid active window '%s', %v", spec, err)
+	}
+	if window.End, err = parseTimeOfDay(to); err != nil {
+		return window, fmt.Errorf("invalid active window '%s', %v", spec, err)
+	}
+	return window, nil
+}
+
+// parseTimeOfDay parses HH:MM into minutes since midnight.
+func parseTimeOfDay(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a time of day", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// contains reports whether t falls in the window. Windows spanning midnight
+// belong to the day they start on.
+func (w activeWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.Start <= w.End {
+		return w.Days[t.Weekday()] && minute >= w.Start && minute < w.End
+	}
+	if minute >= w.Start {
+		return w.Days[t.Weekday()]
+	}
+	return minute < w.End && w.Days[(t.Weekday()+6)%7]
+}
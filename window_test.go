@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActiveWindow(t *testing.T) {
+	// 2024-01-01 is a Monday.
+	for _, c := range []struct {
+		spec     string
+		at       string
+		expected bool
+	}{
+		{"Mon-Fri 09:00-17:00", "2024-01-01 09:00", true},
+		{"Mon-Fri 09:00-17:00", "2024-01-01 17:00", false},
+		{"Mon-Fri 09:00-17:00", "2024-01-06 12:00", false},
+		{"Sat,Sun 00:00-23:59", "2024-01-07 12:00", true},
+		{"Fri-Mon 10:00-11:00", "2024-01-07 10:30", true},
+		{"08:00-09:00", "2024-01-03 08:30", true},
+		{"Fri 22:00-06:00", "2024-01-06 05:00", true},
+		{"Fri 22:00-06:00", "2024-01-05 05:00", false},
+	} {
+		window, err := parseActiveWindow(c.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		at, _ := time.Parse("2006-01-02 15:04", c.at)
+		if got := window.contains(at); got != c.expected {
+			t.Errorf("expected %s to contain %s to be %t", c.spec, c.at, c.expected)
+		}
+	}
+	for _, spec := range []string{"", "Mon-Fri", "Someday 09:00-17:00", "Mon 9-17", "Mon 09:00-25:00"} {
+		if _, err := parseActiveWindow(spec); err == nil {
+			t.Errorf("expected an error for active window '%s'", spec)
+		}
+	}
+}